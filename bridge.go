@@ -0,0 +1,57 @@
+// Copyright 2016 The go-vgo Project Developers. See the COPYRIGHT
+// file at the top-level directory of this distribution and at
+// https://github.com/go-vgo/robotgo/blob/master/LICENSE
+//
+// Licensed under the Apache License, Version 2.0 <LICENSE-APACHE or
+// http://www.apache.org/licenses/LICENSE-2.0> or the MIT license
+// <LICENSE-MIT or http://opensource.org/licenses/MIT>, at your
+// option. This file may not be copied, modified, or distributed
+// except according to those terms.
+
+package hook
+
+// rawEvent is the cgo backend's go_event (event/pub.h): a libuiohook
+// event with its data flattened, as dispatch_proc queues it for Go.
+type rawEvent struct {
+	time      uint64
+	rotation  int32
+	keychar   uint32
+	mask      uint16
+	reserved  uint16
+	keycode   uint16
+	rawcode   uint16
+	button    uint16
+	clicks    uint16
+	amount    uint16
+	x, y      int16
+	kind      uint8
+	direction uint8
+}
+
+// event returns the Event of r, with the fields of its kind set.
+func (r *rawEvent) event() Event {
+	ev := Event{
+		Kind:     r.kind,
+		OSTime:   r.time,
+		Mask:     r.mask,
+		Reserved: r.reserved,
+	}
+
+	switch r.kind {
+	case KeyDown, KeyHold, KeyUp:
+		ev.Keycode = r.keycode
+		ev.Rawcode = r.rawcode
+		ev.Keychar = rune(r.keychar)
+	case MouseUp, MouseHold, MouseDown, MouseMove, MouseDrag:
+		ev.Button = r.button
+		ev.Clicks = r.clicks
+		ev.X, ev.Y = r.x, r.y
+	case MouseWheel:
+		ev.Clicks = r.clicks
+		ev.X, ev.Y = r.x, r.y
+		ev.Amount = r.amount
+		ev.Rotation = r.rotation
+		ev.Direction = r.direction
+	}
+	return ev
+}
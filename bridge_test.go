@@ -0,0 +1,54 @@
+package hook
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/vcaesar/tt"
+)
+
+func TestRawEvent(t *testing.T) {
+	r := rawEvent{kind: MouseWheel, time: 1500, mask: 1, clicks: 1,
+		x: 10, y: -2, amount: 3, rotation: -1, direction: wheelVertical,
+		keychar: 'q'}
+	tt.Equal(t, Event{Kind: MouseWheel, OSTime: 1500, Mask: 1, Clicks: 1,
+		X: 10, Y: -2, Amount: 3, Rotation: -1, Direction: wheelVertical},
+		r.event())
+
+	r = rawEvent{kind: KeyDown, keycode: Keycode["q"], rawcode: 0x71,
+		keychar: 'q', x: 10}
+	tt.Equal(t, Event{Kind: KeyDown, Keycode: Keycode["q"], Rawcode: 0x71,
+		Keychar: 'q'}, r.event())
+}
+
+// jsonWheel is a MouseWheel event as the cgo backend used to format it.
+const jsonWheel = `{"id":11,"time":1500,"mask":0,"reserved":0,"clicks":1,` +
+	`"x":640,"y":360,"type":1,"ammount":3,"rotation":-1,"direction":3}`
+
+// BenchmarkDecodeJSON measures the Go half of the former JSON bridge:
+// copying the C string (C.GoString) and unmarshaling it. The C side's
+// sprintf, channel and poll interval are not included.
+func BenchmarkDecodeJSON(b *testing.B) {
+	b.ReportAllocs()
+	var ev Event
+	for b.Loop() {
+		ev = Event{}
+		if err := json.Unmarshal([]byte(strings.Clone(jsonWheel)), &ev); err != nil {
+			b.Fatal(err)
+		}
+	}
+	_ = ev
+}
+
+// BenchmarkDecodeRaw measures converting a go_event taken from the C ring.
+func BenchmarkDecodeRaw(b *testing.B) {
+	b.ReportAllocs()
+	r := rawEvent{kind: MouseWheel, time: 1500, clicks: 1, x: 640, y: 360,
+		amount: 3, rotation: -1, direction: wheelVertical}
+	var ev Event
+	for b.Loop() {
+		ev = r.event()
+	}
+	_ = ev
+}
@@ -38,9 +38,9 @@
 package hook
 
 import (
+	"os"
 	"runtime"
 	"sync"
-	"time"
 	"unicode/utf8"
 	"unsafe"
 
@@ -52,6 +52,7 @@ const (
 	frameworkCoreGraphics = "/System/Library/Frameworks/CoreGraphics.framework/CoreGraphics"
 	frameworkCoreFound    = "/System/Library/Frameworks/CoreFoundation.framework/CoreFoundation"
 	frameworkAppServices  = "/System/Library/Frameworks/ApplicationServices.framework/ApplicationServices"
+	libSystem             = "/usr/lib/libSystem.B.dylib"
 )
 
 // CGEventType values (CGEventTypes.h). NOTE: these are the *native* Quartz
@@ -83,8 +84,13 @@ const (
 	fieldScrollWheelDelta1 uint32 = 11
 	fieldScrollWheelDelta2 uint32 = 12
 	fieldMouseButtonNumber uint32 = 23
+	fieldSourceUnixPID     uint32 = 41
+	fieldSourceStateID     uint32 = 45
 )
 
+// kCGEventSourceStateHIDSystemState, the source state of device input.
+const sourceStateHIDSystem = 1
+
 // CGEventFlags modifier masks (CGEventTypes.h).
 const (
 	flagAlphaShift uint64 = 0x00010000 // caps lock
@@ -94,15 +100,6 @@ const (
 	flagCommand    uint64 = 0x00100000
 )
 
-// gohook virtual modifier masks (mirrors hook/iohook.h MASK_* for Event.Mask).
-const (
-	maskShiftL   uint16 = 1 << 0
-	maskCtrlL    uint16 = 1 << 1
-	maskMetaL    uint16 = 1 << 2
-	maskAltL     uint16 = 1 << 3
-	maskCapsLock uint16 = 1 << 14
-)
-
 // CGEventTap creation parameters (CGEventTypes.h).
 const (
 	cgSessionEventTap          uint32 = 1
@@ -110,12 +107,6 @@ const (
 	cgEventTapOptionListenOnly uint32 = 1
 )
 
-// libuiohook-compatible scroll directions (matches the CGo backend).
-const (
-	wheelVertical   uint8 = 3
-	wheelHorizontal uint8 = 4
-)
-
 // Native darwin virtual keycodes for modifier keys (HIToolbox kVK_*), used to
 // turn kCGEventFlagsChanged into discrete KeyDown/KeyUp events.
 const (
@@ -136,6 +127,12 @@ type cgPoint struct {
 	x, y float64
 }
 
+// machTimebase mirrors mach_timebase_info_data_t: a mach_absolute_time tick
+// is numer/denom nanoseconds.
+type machTimebase struct {
+	numer, denom uint32
+}
+
 // Lazily-bound framework functions. Resolved once by initDarwin().
 var (
 	cgEventTapCreate            func(tap, place, options uint32, mask uint64, cb, userInfo uintptr) uintptr
@@ -143,6 +140,7 @@ var (
 	cgEventGetIntegerValueField func(event uintptr, field uint32) int64
 	cgEventGetFlags             func(event uintptr) uint64
 	cgEventGetLocation          func(event uintptr) cgPoint
+	cgEventGetTimestamp         func(event uintptr) uint64
 
 	cfMachPortCreateRunLoopSource func(allocator, port uintptr, order int) uintptr
 	cfMachPortInvalidate          func(port uintptr)
@@ -156,6 +154,8 @@ var (
 
 	axIsProcessTrusted func() bool
 
+	machTimebaseInfo func(info *machTimebase) int32
+
 	kCFRunLoopCommonModes uintptr
 	cgCallbackPtr         uintptr
 
@@ -163,7 +163,7 @@ var (
 	darwinInitErr error
 )
 
-// darwinState holds the live tap objects so End() can tear them down.
+// darwinState holds the live tap objects so stopBackend() can tear them down.
 // Guarded by the package-level lck mutex.
 type darwinState struct {
 	tapPort uintptr
@@ -192,12 +192,18 @@ func initDarwin() error {
 			darwinInitErr = err
 			return
 		}
+		sys, err := purego.Dlopen(libSystem, purego.RTLD_NOW|purego.RTLD_GLOBAL)
+		if err != nil {
+			darwinInitErr = err
+			return
+		}
 
 		purego.RegisterLibFunc(&cgEventTapCreate, cg, "CGEventTapCreate")
 		purego.RegisterLibFunc(&cgEventTapEnable, cg, "CGEventTapEnable")
 		purego.RegisterLibFunc(&cgEventGetIntegerValueField, cg, "CGEventGetIntegerValueField")
 		purego.RegisterLibFunc(&cgEventGetFlags, cg, "CGEventGetFlags")
 		purego.RegisterLibFunc(&cgEventGetLocation, cg, "CGEventGetLocation")
+		purego.RegisterLibFunc(&cgEventGetTimestamp, cg, "CGEventGetTimestamp")
 
 		purego.RegisterLibFunc(&cfMachPortCreateRunLoopSource, cf, "CFMachPortCreateRunLoopSource")
 		purego.RegisterLibFunc(&cfMachPortInvalidate, cf, "CFMachPortInvalidate")
@@ -211,6 +217,12 @@ func initDarwin() error {
 
 		purego.RegisterLibFunc(&axIsProcessTrusted, as, "AXIsProcessTrusted")
 
+		purego.RegisterLibFunc(&machTimebaseInfo, sys, "mach_timebase_info")
+		var tb machTimebase
+		if machTimebaseInfo(&tb) == 0 && tb.denom != 0 {
+			osTime.numer, osTime.denom = uint64(tb.numer), uint64(tb.denom)
+		}
+
 		// kCFRunLoopCommonModes is an exported CFStringRef variable; the symbol
 		// address points at the pointer, so dereference once to get the value.
 		// The double indirection through &sym keeps `go vet` (unsafeptr) happy:
@@ -228,33 +240,29 @@ func initDarwin() error {
 	return darwinInitErr
 }
 
-// Start adds the macOS event tap and returns the event channel.
+// backendName names this backend in Snapshot.
+const backendName = "darwin"
+
+// osTime maps CGEventGetTimestamp, in mach_absolute_time ticks; initDarwin
+// sets their length.
+var osTime = newOSClock(1, 1, false)
+
+// runBackend runs the macOS event tap until stopBackend is called.
 //
 // The optional timeout argument is accepted for API parity with the CGo
 // backend but is ignored: this backend is event-driven (it blocks on the
 // CFRunLoop) rather than polled.
-func Start(tm ...int) chan Event {
+func runBackend(tm ...int) {
 	_ = tm
 
-	ev = make(chan Event, 1024)
-	asyncon = true
-
-	go darwinLoop()
-
-	return ev
+	darwinLoop()
 }
 
-// End removes the event tap and resets all hook state.
-func End(tm ...int) {
-	tm1 := 10
-	if len(tm) > 0 {
-		tm1 = tm[0]
-	}
-
-	asyncon = false
-
+// stopBackend removes the event tap.
+func stopBackend() {
 	lck.Lock()
 	st := mac
+	mac = nil
 	lck.Unlock()
 
 	// Stopping the run loop unblocks darwinLoop's CFRunLoopRun and triggers
@@ -262,19 +270,13 @@ func End(tm ...int) {
 	if st != nil && st.runLoop != 0 {
 		cfRunLoopStop(st.runLoop)
 	}
+}
 
-	time.Sleep(time.Millisecond * time.Duration(tm1))
-
-	for len(ev) != 0 {
-		<-ev
-	}
-	close(ev)
-
-	resetState()
-
-	lck.Lock()
-	mac = nil
-	lck.Unlock()
+// subscribe: the event tap sees every event; send drops the kinds nobody
+// wants.
+func subscribe(kinds kindSet) error {
+	_ = kinds
+	return nil
 }
 
 // addEvent: the single-shot *blocking* listener (AddEvent/StopEvent) is a
@@ -290,8 +292,21 @@ func addEvent(key string) int {
 // StopEvent is a no-op on the pure-Go macOS backend (see addEvent).
 func StopEvent() {}
 
+// postEvent: posting synthetic events is not implemented on the pure-Go
+// macOS backend.
+func postEvent(ev Event) error {
+	_ = ev
+	return ErrNotSupported
+}
+
+// grabHotkey: grabs are implemented on the pure-Go X11 backend only.
+func grabHotkey(hk Hotkey) (release func(), err error) {
+	_ = hk
+	return nil, ErrNotSupported
+}
+
 // darwinLoop creates the event tap, wires it into a CFRunLoop and pumps the
-// loop until End() stops it.
+// loop until stopBackend() stops it.
 func darwinLoop() {
 	// The tap, its run-loop source and CFRunLoopRun must all live on one OS
 	// thread.
@@ -299,20 +314,20 @@ func darwinLoop() {
 	defer runtime.UnlockOSThread()
 
 	if err := initDarwin(); err != nil {
-		send(Event{Kind: HookDisabled})
+		fail(wrapErr(ErrBackend, err))
 		return
 	}
 
 	// A session tap only delivers events with the Accessibility privilege.
 	if !axIsProcessTrusted() {
-		send(Event{Kind: HookDisabled})
+		fail(ErrAccessDenied)
 		return
 	}
 
 	port := cgEventTapCreate(cgSessionEventTap, cgHeadInsertEventTap,
 		cgEventTapOptionListenOnly, cgEventMask(), cgCallbackPtr, 0)
 	if port == 0 {
-		send(Event{Kind: HookDisabled})
+		fail(ErrHookInstall)
 		return
 	}
 
@@ -320,7 +335,7 @@ func darwinLoop() {
 	if source == 0 {
 		cfMachPortInvalidate(port)
 		cfRelease(port)
-		send(Event{Kind: HookDisabled})
+		fail(ErrHookInstall)
 		return
 	}
 
@@ -334,7 +349,7 @@ func darwinLoop() {
 
 	send(Event{Kind: HookEnabled})
 
-	// Blocks here until End() calls CFRunLoopStop.
+	// Blocks here until stopBackend() calls CFRunLoopStop.
 	cfRunLoopRun()
 
 	// Teardown.
@@ -383,18 +398,34 @@ func eventCallback(proxy, typ, event, refcon uintptr) uintptr {
 		return event
 	}
 
-	if !asyncon {
+	if !asyncon.Load() {
 		return event
 	}
 
 	if e, ok := buildEvent(t, event); ok {
-		send(e)
+		e.OSTime = cgEventGetTimestamp(event)
+		send(eventSource(e, event))
 	}
 
 	// ListenOnly taps ignore the return value, but pass the event through.
 	return event
 }
 
+// eventSource tags e as synthetic unless the Quartz event came from the HID
+// system, that is from a device. Input posted by this process is
+// SourceSelf.
+func eventSource(e Event, event uintptr) Event {
+	if cgEventGetIntegerValueField(event, fieldSourceStateID) == sourceStateHIDSystem {
+		return e
+	}
+
+	e.Synthetic, e.Source = true, SourceOther
+	if cgEventGetIntegerValueField(event, fieldSourceUnixPID) == int64(os.Getpid()) {
+		e.Source = SourceSelf
+	}
+	return e
+}
+
 // buildEvent translates a native Quartz event into a gohook Event.
 func buildEvent(t uint32, event uintptr) (Event, bool) {
 	switch t {
@@ -571,21 +602,3 @@ func maskFromFlags(flags uint64) uint16 {
 	}
 	return m
 }
-
-// send timestamps and pushes an event onto the global channel. It drops the
-// event (rather than blocking the run-loop thread) if no consumer keeps up and
-// the buffer is full. The recover guards the small shutdown window where End()
-// may have closed ev while a tap callback is still in flight.
-func send(e Event) {
-	if !asyncon {
-		return
-	}
-	defer func() { _ = recover() }() // ev closed by End(): drop silently
-
-	e.When = time.Now()
-	select {
-	case ev <- e:
-	default:
-		// channel full: drop to avoid stalling the event tap.
-	}
-}
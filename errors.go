@@ -0,0 +1,73 @@
+// Copyright 2016 The go-vgo Project Developers. See the COPYRIGHT
+// file at the top-level directory of this distribution and at
+// https://github.com/go-vgo/robotgo/blob/master/LICENSE
+//
+// Licensed under the Apache License, Version 2.0 <LICENSE-APACHE or
+// http://www.apache.org/licenses/LICENSE-2.0> or the MIT license
+// <LICENSE-MIT or http://opensource.org/licenses/MIT>, at your
+// option. This file may not be copied, modified, or distributed
+// except according to those terms.
+
+package hook
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Errors reported by StartContext when the backend cannot start. Backends
+// wrap them with the underlying cause, so test with errors.Is.
+var (
+	// ErrNoDisplay means the display server (X11 $DISPLAY or the Wayland
+	// compositor) could not be reached.
+	ErrNoDisplay = errors.New("hook: cannot connect to the display server")
+	// ErrAuthRefused means the X server refused the connection setup.
+	ErrAuthRefused = errors.New("hook: X authentication refused")
+	// ErrRecordUnavailable means the X server has no RECORD extension.
+	ErrRecordUnavailable = errors.New("hook: X RECORD extension unavailable")
+	// ErrRecordContext means the RECORD context could not be created or
+	// enabled.
+	ErrRecordContext = errors.New("hook: cannot set up X RECORD context")
+	// ErrNoSeat means the Wayland compositor advertised no wl_seat.
+	ErrNoSeat = errors.New("hook: no Wayland seat")
+	// ErrAccessDenied means the process lacks the OS privilege to observe
+	// input (the Accessibility permission on macOS).
+	ErrAccessDenied = errors.New("hook: input monitoring access denied")
+	// ErrHookInstall means the OS refused to install the hook (Win32
+	// SetWindowsHookEx, or the macOS event tap and its run loop).
+	ErrHookInstall = errors.New("hook: cannot install OS event hook")
+	// ErrOutOfMemory means the native hook library ran out of memory.
+	ErrOutOfMemory = errors.New("hook: out of memory")
+	// ErrBackend is any other backend failure.
+	ErrBackend = errors.New("hook: backend failure")
+)
+
+// ErrUnknownKey is returned by Register for a key name missing from Keycode.
+var ErrUnknownKey = errors.New("hook: unknown key name")
+
+// ErrInvalidHotkey is returned by ParseHotkey for a malformed accelerator.
+var ErrInvalidHotkey = errors.New("hook: invalid hotkey")
+
+// wrapErr annotates a sentinel error with its underlying cause.
+func wrapErr(sentinel, cause error) error {
+	if cause == nil {
+		return sentinel
+	}
+	return fmt.Errorf("%w: %v", sentinel, cause)
+}
+
+// ErrNotSupported is returned by Post for an event the backend cannot
+// post.
+var ErrNotSupported = errors.New("hook: not supported by this backend")
+
+// ErrGrabConflict is returned by RegisterGrab when another client already
+// grabs the hotkey.
+var ErrGrabConflict = errors.New("hook: hotkey grabbed by another client")
+
+// ErrNotRunning is returned by Post and RegisterGrab on a backend that
+// works through the running hook when no Hook is running.
+var ErrNotRunning = errors.New("hook: not running")
+
+// ErrAlreadyRunning is returned by StartContext for a Hook that is already
+// starting or running.
+var ErrAlreadyRunning = errors.New("hook: already running")
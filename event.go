@@ -59,8 +59,9 @@ func AddEvent(key string) bool {
 // hook.AddEvents("q", "ctrl")
 // hook.AddEvents("q", "ctrl", "shift")
 func AddEvents(key string, arr ...string) bool {
-	s := Start()
-	// defer End()
+	h := New(Options{})
+	s := h.Start()
+	// defer h.End()
 
 	ct := false
 	k := 0
@@ -92,7 +93,7 @@ func AddEvents(key string, arr ...string) bool {
 		}
 
 		if ct && e.Kind == KeyUp && e.Keycode == Keycode[key] {
-			End()
+			h.End()
 			// k = 0
 			break
 		}
@@ -109,7 +110,8 @@ func AddEvents(key string, arr ...string) bool {
 // hook.AddMouse("left")
 // hook.AddMouse("left", 100, 100)
 func AddMouse(btn string, x ...int16) bool {
-	s := Start()
+	h := New(Options{})
+	s := h.Start()
 	ukey := MouseMap[btn]
 
 	ct := false
@@ -125,7 +127,7 @@ func AddMouse(btn string, x ...int16) bool {
 		}
 
 		if ct && e.Kind == MouseDown && e.Button == ukey {
-			End()
+			h.End()
 			break
 		}
 	}
@@ -135,12 +137,13 @@ func AddMouse(btn string, x ...int16) bool {
 
 // AddMousePos add listen mouse event pos hook
 func AddMousePos(x, y int16) bool {
-	s := Start()
+	h := New(Options{})
+	s := h.Start()
 
 	for {
 		e := <-s
 		if e.Kind == MouseMove && e.X == x && e.Y == y {
-			End()
+			h.End()
 			break
 		}
 	}
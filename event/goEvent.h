@@ -15,41 +15,29 @@
 #endif
 
 #include <stdlib.h>
+#ifdef __APPLE__
+	#include <mach/mach_time.h>
+#endif
 #include "pub.h"
-// #include "../chan/eb_chan.h"
 #include "dispatch_proc.h"
 
-void go_send(char*);
-void go_sleep(void);
-
-void start_ev(){
-    events = eb_chan_create(1024);
-    eb_chan_retain(events);
-	sending = true;
+int start_ev(){
 	// add_event("q");
-	add_event_async();
-}
-
-void pollEv(){
-    if (events == NULL) { return; }
-	
-    for (;eb_chan_buf_len(events)!=0;) {
-        char* tmp;
-        if (eb_chan_try_recv(events, (const void**) &tmp) 
-			== eb_chan_res_ok) {
-			// send a char
-            go_send(tmp);
-            free(tmp);
-        } else {
-            //
-        }
-    }
+	return add_event_async();
 }
 
-void endPoll(){
-	sending = false;
-	pollEv(); // remove last things from channel
-	eb_chan_release(events);
+// os_tick_ns reports the length of an event->time tick as numer/denom
+// nanoseconds.
+void os_tick_ns(uint64_t *numer, uint64_t *denom){
+#ifdef __APPLE__
+	mach_timebase_info_data_t tb;
+	mach_timebase_info(&tb);
+	*numer = tb.numer;
+	*denom = tb.denom;
+#else
+	*numer = 1000000;
+	*denom = 1;
+#endif
 }
 
 int add_event(char *key_event) {
@@ -60,8 +48,8 @@ int add_event(char *key_event) {
 	return cstatus;
 }
 
-void add_event_async(){
-	add_hook(&dispatch_proc);
+int add_event_async(){
+	return add_hook(&dispatch_proc);
 }
 
 int add_hook(dispatcher_t dispatch) {
@@ -170,4 +158,37 @@ int stop_event(){
 	return status;
 }
 
+// post_ev builds an iohook_event from the Go Event fields and posts it.
+void post_ev(int type, uint16_t mask, uint16_t keycode, uint16_t button,
+		int16_t x, int16_t y, int32_t rotation, uint8_t direction) {
+	iohook_event event = { .type = type, .mask = mask };
+
+	switch (type) {
+		case EVENT_KEY_PRESSED:
+		case EVENT_KEY_RELEASED:
+			event.data.keyboard.keycode = keycode;
+			event.data.keyboard.keychar = CHAR_UNDEFINED;
+			break;
+
+		case EVENT_MOUSE_WHEEL:
+			event.data.wheel.clicks = 1;
+			event.data.wheel.x = x;
+			event.data.wheel.y = y;
+			event.data.wheel.type = WHEEL_UNIT_SCROLL;
+			event.data.wheel.amount = 1;
+			event.data.wheel.rotation = rotation;
+			event.data.wheel.direction = direction;
+			break;
+
+		default:
+			event.data.mouse.button = button;
+			event.data.mouse.clicks = 1;
+			event.data.mouse.x = x;
+			event.data.mouse.y = y;
+			break;
+	}
+
+	hook_post_event(&event);
+}
+
 #endif
\ No newline at end of file
@@ -35,10 +35,7 @@
 #include <string.h>
 
 #include "../hook/iohook.h"
-#include "../chan/eb_chan.h"
-
-eb_chan events;
-bool sending = false;
+#include "ring.h"
 
 int vccode[100];
 int codesz;
@@ -50,7 +47,7 @@ int event_status;
 int rrevent;
 
 int add_hook(dispatcher_t dispatch);
-void add_event_async();
+int add_event_async();
 int add_event(char *key_event);
 int stop_event();
 
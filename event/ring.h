@@ -0,0 +1,208 @@
+// Copyright 2016 The go-vgo Project Developers. See the COPYRIGHT
+// file at the top-level directory of this distribution and at
+// https://github.com/go-vgo/robotgo/blob/master/LICENSE
+//
+// Licensed under the Apache License, Version 2.0 <LICENSE-APACHE or
+// http://www.apache.org/licenses/LICENSE-2.0> or the MIT license
+// <LICENSE-MIT or http://opensource.org/licenses/MIT>, at your
+// option. This file may not be copied, modified, or distributed
+// except according to those terms.
+
+#ifndef ring_h
+#define ring_h
+
+// The queue from libuiohook's hook thread to the Go poller. It needs only
+// the iohook_event type, not the platform hooks.
+
+#include "os.h"
+#include <stdbool.h>
+#include <stdint.h>
+#include <stdio.h>
+#include "../hook/iohook.h"
+
+// go_event is an iohook_event with its data flattened, as dispatch_proc
+// passes it to Go (rawEvent in bridge.go).
+typedef struct {
+	uint64_t time;
+	int32_t rotation;
+	uint32_t keychar;
+	uint16_t mask;
+	uint16_t reserved;
+	uint16_t keycode;
+	uint16_t rawcode;
+	uint16_t button;
+	uint16_t clicks;
+	uint16_t amount;
+	int16_t x;
+	int16_t y;
+	uint8_t type;
+	uint8_t direction;
+} go_event;
+
+// ring is a single-producer, single-consumer queue from the hook thread
+// (dispatch_proc) to Go (take_events). ring_head and ring_tail count the
+// events written and read.
+#define RING_SIZE 1024
+go_event ring[RING_SIZE];
+uint32_t ring_head = 0;
+uint32_t ring_tail = 0;
+
+bool sending = false;
+
+// ring_lock and ring_cond wake the Go poller (wait_events) when
+// dispatch_proc queues an event into the empty ring, or the hook stops.
+#if defined(IS_WINDOWS)
+	SRWLOCK ring_lock = SRWLOCK_INIT;
+	CONDITION_VARIABLE ring_cond = CONDITION_VARIABLE_INIT;
+
+	#define ring_enter() AcquireSRWLockExclusive(&ring_lock)
+	#define ring_leave() ReleaseSRWLockExclusive(&ring_lock)
+	#define ring_wait() SleepConditionVariableSRW(&ring_cond, &ring_lock, INFINITE, 0)
+	#define ring_wake() WakeConditionVariable(&ring_cond)
+#else
+	#include <pthread.h>
+
+	pthread_mutex_t ring_lock = PTHREAD_MUTEX_INITIALIZER;
+	pthread_cond_t ring_cond = PTHREAD_COND_INITIALIZER;
+
+	#define ring_enter() pthread_mutex_lock(&ring_lock)
+	#define ring_leave() pthread_mutex_unlock(&ring_lock)
+	#define ring_wait() pthread_cond_wait(&ring_cond, &ring_lock)
+	#define ring_wake() pthread_cond_signal(&ring_cond)
+#endif
+
+// wake_poller wakes wait_events.
+void wake_poller() {
+	ring_enter();
+	ring_wake();
+	ring_leave();
+}
+// want_kinds has a bit set for each event type to send, see subscribe.
+uint32_t want_kinds = 0xFFFFFFFF;
+// dropped_events counts the events dispatch_proc found no room for.
+uint32_t dropped_events = 0;
+
+void dispatch_proc(iohook_event * const event) {
+	if (!__atomic_load_n(&sending, __ATOMIC_ACQUIRE)) { return; }
+	if (event->type >= 32 ||
+		!(__atomic_load_n(&want_kinds, __ATOMIC_RELAXED) & (1u << event->type))) {
+		return;
+	}
+
+	go_event ev = { 0 };
+	ev.type = event->type;
+	ev.time = event->time;
+	ev.mask = event->mask;
+	ev.reserved = event->reserved;
+
+	switch (event->type) {
+		case EVENT_HOOK_ENABLED:
+		case EVENT_HOOK_DISABLED:
+			break;
+		case EVENT_KEY_PRESSED:
+		case EVENT_KEY_RELEASED:
+		case EVENT_KEY_TYPED:
+			ev.keycode = event->data.keyboard.keycode;
+			ev.rawcode = event->data.keyboard.rawcode;
+			ev.keychar = event->data.keyboard.keychar;
+			break;
+		case EVENT_MOUSE_PRESSED:
+		case EVENT_MOUSE_RELEASED:
+		case EVENT_MOUSE_CLICKED:
+		case EVENT_MOUSE_MOVED:
+		case EVENT_MOUSE_DRAGGED:
+			ev.button = event->data.mouse.button;
+			ev.clicks = event->data.mouse.clicks;
+			ev.x = event->data.mouse.x;
+			ev.y = event->data.mouse.y;
+			break;
+		case EVENT_MOUSE_WHEEL:
+			ev.clicks = event->data.wheel.clicks;
+			ev.x = event->data.wheel.x;
+			ev.y = event->data.wheel.y;
+			ev.amount = event->data.wheel.amount;
+			ev.rotation = event->data.wheel.rotation;
+			ev.direction = event->data.wheel.direction;
+			break;
+		default:
+			fprintf(stderr,"\nError on file: %s, unusual event->type: %i\n",__FILE__,event->type);
+			return;
+	}
+
+	// never block the hook callback: a full ring drops the event.
+	uint32_t head = __atomic_load_n(&ring_head, __ATOMIC_RELAXED);
+	if (head - __atomic_load_n(&ring_tail, __ATOMIC_ACQUIRE) >= RING_SIZE) {
+		__atomic_add_fetch(&dropped_events, 1, __ATOMIC_RELAXED);
+		return;
+	}
+	ring[head % RING_SIZE] = ev;
+	__atomic_store_n(&ring_head, head + 1, __ATOMIC_SEQ_CST);
+
+	// wake the poller only if the ring was empty. Both sides order their
+	// head and tail accesses seq_cst, so a poller about to wait either
+	// sees this event or is seen here.
+	if (__atomic_load_n(&ring_tail, __ATOMIC_SEQ_CST) == head) {
+		wake_poller();
+	}
+}
+
+// start_poll empties the ring and opens it to dispatch_proc, before the
+// hook starts.
+void start_poll(){
+	ring_enter();
+	__atomic_store_n(&ring_head, 0, __ATOMIC_RELAXED);
+	__atomic_store_n(&ring_tail, 0, __ATOMIC_RELAXED);
+	__atomic_store_n(&sending, true, __ATOMIC_RELEASE);
+	ring_leave();
+}
+
+// take_events moves up to max queued events to out and returns how many.
+int take_events(go_event *out, int max){
+	uint32_t tail = __atomic_load_n(&ring_tail, __ATOMIC_RELAXED);
+	uint32_t head = __atomic_load_n(&ring_head, __ATOMIC_ACQUIRE);
+	int n = 0;
+	for (; tail != head && n < max; tail++, n++) {
+		out[n] = ring[tail % RING_SIZE];
+	}
+	__atomic_store_n(&ring_tail, tail, __ATOMIC_SEQ_CST);
+	return n;
+}
+
+// wait_events blocks until events are queued, then takes them like
+// take_events. It returns -1 once the hook has stopped and every event is
+// taken.
+int wait_events(go_event *out, int max){
+	ring_enter();
+	while (__atomic_load_n(&sending, __ATOMIC_ACQUIRE) &&
+			__atomic_load_n(&ring_head, __ATOMIC_SEQ_CST) ==
+			__atomic_load_n(&ring_tail, __ATOMIC_RELAXED)) {
+		ring_wait();
+	}
+	// once sending is off, no event comes after the ones queued.
+	bool open = __atomic_load_n(&sending, __ATOMIC_ACQUIRE);
+	ring_leave();
+
+	int n = take_events(out, max);
+	if (n == 0 && !open) {
+		return -1;
+	}
+	return n;
+}
+
+void set_want_kinds(uint32_t kinds){
+	__atomic_store_n(&want_kinds, kinds, __ATOMIC_RELAXED);
+}
+
+uint32_t take_dropped(){
+	return __atomic_exchange_n(&dropped_events, 0, __ATOMIC_RELAXED);
+}
+
+// endPoll stops wait_events, once the hook has stopped.
+void endPoll(){
+	ring_enter();
+	__atomic_store_n(&sending, false, __ATOMIC_RELEASE);
+	ring_wake();
+	ring_leave();
+}
+
+#endif
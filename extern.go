@@ -2,28 +2,14 @@
 
 package hook
 
-/*
-// #include "event/hook_async.h"
-*/
-import "C"
-
 import (
-	"log"
 	"runtime"
 	"time"
-
-	"encoding/json"
 )
 
-//export go_send
-func go_send(s *C.char) {
-	str := []byte(C.GoString(s))
-	out := Event{}
-
-	err := json.Unmarshal(str, &out)
-	if err != nil {
-		log.Fatal("json.Unmarshal error is: ", err)
-	}
+// sendRaw delivers an event the poller took from the C ring.
+func sendRaw(r *rawEvent) {
+	out := r.event()
 
 	if out.Keychar != CharUndefined {
 		lck.Lock()
@@ -38,9 +24,7 @@ func go_send(s *C.char) {
 		lck.Unlock()
 	}
 
-	// todo bury this deep into the C lib so that the time is correct
-	out.When = time.Now() // at least it's consistent
-
-	// todo: maybe make non-bloking
-	ev <- out
+	// OSTime is libuiohook's event time, which send() maps onto the wall
+	// clock for When.
+	send(posted.tag(out, time.Now()))
 }
@@ -0,0 +1,287 @@
+// Copyright 2016 The go-vgo Project Developers. See the COPYRIGHT
+// file at the top-level directory of this distribution and at
+// https://github.com/go-vgo/robotgo/blob/master/LICENSE
+//
+// Licensed under the Apache License, Version 2.0 <LICENSE-APACHE or
+// http://www.apache.org/licenses/LICENSE-2.0> or the MIT license
+// <LICENSE-MIT or http://opensource.org/licenses/MIT>, at your
+// option. This file may not be copied, modified, or distributed
+// except according to those terms.
+
+package hook
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Clock is the time source of the timing-aware recognizers. Their options
+// take one, the system clock if nil, so tests can substitute a fake one.
+type Clock interface {
+	Now() time.Time
+	AfterFunc(d time.Duration, f func()) Timer
+}
+
+// Timer is a pending Clock.AfterFunc call.
+type Timer interface {
+	Stop() bool
+}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time { return time.Now() }
+
+func (systemClock) AfterFunc(d time.Duration, f func()) Timer {
+	return time.AfterFunc(d, f)
+}
+
+// clockOr returns clock, or the system clock if clock is nil.
+func clockOr(clock Clock) Clock {
+	if clock == nil {
+		return systemClock{}
+	}
+	return clock
+}
+
+// feedAll runs feed on the events read from evChan, then flush, if any,
+// and signals out once evChan is closed. It backs the recognizers' Process
+// methods.
+func feedAll(evChan <-chan Event, feed func(Event), flush func()) (out chan bool) {
+	out = make(chan bool)
+	go func() {
+		for ev := range evChan {
+			feed(ev)
+		}
+		if flush != nil {
+			flush()
+		}
+		out <- true
+	}()
+	return
+}
+
+// GestureOptions configures a Gestures.
+type GestureOptions struct {
+	// Clock times double taps and long presses.
+	Clock Clock
+}
+
+// keySpec is a key named in a gesture: a keycode, or a modifier on one or
+// either side.
+type keySpec struct {
+	code uint16
+	mod  Modifier
+}
+
+func parseKeySpec(name string) (keySpec, error) {
+	if m, ok := modAlias[name]; ok {
+		return keySpec{mod: m}, nil
+	}
+	if code, ok := Keycode[name]; ok {
+		return keySpec{code: code}, nil
+	}
+	return keySpec{}, fmt.Errorf("%w %q", ErrUnknownKey, name)
+}
+
+func (k keySpec) is(code uint16) bool {
+	if k.mod != 0 {
+		return modCodes[code]&k.mod != 0
+	}
+	return k.code == code
+}
+
+// Gesture kinds.
+const (
+	gestureTap = iota
+	gestureDoubleTap
+	gestureLongPress
+)
+
+type gesture struct {
+	kind int
+	key  keySpec
+	d    time.Duration
+	cb   func(Event)
+}
+
+// press is a key held down.
+type press struct {
+	ev    Event
+	at    time.Time
+	clean bool // no other key or button pressed since
+	long  bool // a long press fired
+	timer []Timer
+}
+
+// Gestures recognizes taps, double taps and long presses of single keys
+// in an event stream. A tap is a press and release of the key with no
+// other key or mouse button pressed in between.
+//
+// Callbacks run on the goroutine calling Feed, or for long presses on a
+// Clock timer goroutine.
+type Gestures struct {
+	clock Clock
+
+	mu       sync.Mutex
+	gestures []gesture
+	down     map[uint16]*press
+	lastTap  Event // the last clean tap, or zero
+	lastAt   time.Time
+}
+
+// NewGestures returns a Gestures with no gestures registered.
+func NewGestures(opts GestureOptions) *Gestures {
+	return &Gestures{clock: clockOr(opts.Clock), down: map[uint16]*press{}}
+}
+
+func (g *Gestures) add(kind int, key string, d time.Duration, cb func(Event)) error {
+	k, err := parseKeySpec(key)
+	if err != nil {
+		return err
+	}
+
+	g.mu.Lock()
+	g.gestures = append(g.gestures, gesture{kind: kind, key: k, d: d, cb: cb})
+	g.mu.Unlock()
+	return nil
+}
+
+// OnTap runs cb when key is tapped. key is a Keycode name or a modifier
+// token such as "shift" or "rctrl".
+func (g *Gestures) OnTap(key string, cb func(Event)) error {
+	return g.add(gestureTap, key, 0, cb)
+}
+
+// OnDoubleTap runs cb when key is tapped twice, the second press coming
+// within interval of the first release.
+func (g *Gestures) OnDoubleTap(key string, interval time.Duration, cb func(Event)) error {
+	return g.add(gestureDoubleTap, key, interval, cb)
+}
+
+// OnLongPress runs cb once key has been held for duration with no other key
+// or button pressed. The key is then no longer a tap when released.
+func (g *Gestures) OnLongPress(key string, duration time.Duration, cb func(Event)) error {
+	return g.add(gestureLongPress, key, duration, cb)
+}
+
+// Process runs Feed on the events read from evChan, and signals out once
+// evChan is closed.
+func (g *Gestures) Process(evChan <-chan Event) (out chan bool) {
+	return feedAll(evChan, g.Feed, nil)
+}
+
+// Feed passes one event to the recognizers.
+func (g *Gestures) Feed(ev Event) {
+	at := ev.When
+	if at.IsZero() {
+		at = g.clock.Now()
+	}
+
+	var fire []func()
+	g.mu.Lock()
+	switch ev.Kind {
+	case KeyDown:
+		if g.down[ev.Keycode] != nil {
+			break // auto-repeat
+		}
+		g.interrupt(ev.Keycode)
+		p := &press{ev: ev, at: at, clean: true}
+		g.down[ev.Keycode] = p
+		g.armLongPress(p, at)
+
+	case KeyUp:
+		p := g.down[ev.Keycode]
+		delete(g.down, ev.Keycode)
+		if p == nil {
+			break
+		}
+		p.stop()
+		if !p.clean || p.long {
+			g.lastTap = Event{}
+			break
+		}
+		fire = g.tapped(ev, p, at)
+
+	case MouseDown:
+		g.interrupt(0)
+	}
+	g.mu.Unlock()
+
+	for _, f := range fire {
+		f()
+	}
+}
+
+// interrupt marks every held key other than code as no longer clean.
+func (g *Gestures) interrupt(code uint16) {
+	for c, p := range g.down {
+		if c != code {
+			p.clean = false
+			p.stop()
+		}
+	}
+	if g.lastTap.Keycode != code {
+		g.lastTap = Event{}
+	}
+}
+
+func (g *Gestures) armLongPress(p *press, at time.Time) {
+	for _, gs := range g.gestures {
+		if gs.kind != gestureLongPress || !gs.key.is(p.ev.Keycode) {
+			continue
+		}
+
+		cb := gs.cb
+		d := gs.d - g.clock.Now().Sub(at)
+		p.timer = append(p.timer, g.clock.AfterFunc(d, func() {
+			g.mu.Lock()
+			ok := g.down[p.ev.Keycode] == p && p.clean
+			if ok {
+				p.long = true
+			}
+			g.mu.Unlock()
+
+			if ok {
+				cb(p.ev)
+			}
+		}))
+	}
+}
+
+// tapped handles the release of a clean tap, returning the callbacks to
+// run.
+func (g *Gestures) tapped(ev Event, p *press, at time.Time) (fire []func()) {
+	double := false
+	for _, gs := range g.gestures {
+		if !gs.key.is(ev.Keycode) {
+			continue
+		}
+
+		cb := gs.cb
+		switch gs.kind {
+		case gestureTap:
+			fire = append(fire, func() { cb(ev) })
+		case gestureDoubleTap:
+			if g.lastTap.Kind != 0 && gs.key.is(g.lastTap.Keycode) &&
+				p.at.Sub(g.lastAt) <= gs.d {
+				double = true
+				fire = append(fire, func() { cb(ev) })
+			}
+		}
+	}
+
+	if double {
+		g.lastTap = Event{}
+	} else {
+		g.lastTap, g.lastAt = ev, at
+	}
+	return fire
+}
+
+func (p *press) stop() {
+	for _, t := range p.timer {
+		t.Stop()
+	}
+	p.timer = nil
+}
@@ -0,0 +1,141 @@
+package hook
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/vcaesar/tt"
+)
+
+// fakeClock is a manually advanced Clock.
+type fakeClock struct {
+	mu     sync.Mutex
+	now    time.Time
+	timers []*fakeTimer
+}
+
+type fakeTimer struct {
+	c    *fakeClock
+	at   time.Time
+	f    func()
+	done bool
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) AfterFunc(d time.Duration, f func()) Timer {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	t := &fakeTimer{c: c, at: c.now.Add(d), f: f}
+	c.timers = append(c.timers, t)
+	return t
+}
+
+func (t *fakeTimer) Stop() bool {
+	t.c.mu.Lock()
+	defer t.c.mu.Unlock()
+	was := !t.done
+	t.done = true
+	return was
+}
+
+// Advance moves the clock forward and runs the timers that came due.
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	c.now = c.now.Add(d)
+	var due []func()
+	for _, t := range c.timers {
+		if !t.done && !t.at.After(c.now) {
+			t.done = true
+			due = append(due, t.f)
+		}
+	}
+	c.mu.Unlock()
+
+	for _, f := range due {
+		f()
+	}
+}
+
+// recorder records which recognizer callbacks fire.
+type recorder struct {
+	got []string
+}
+
+func (r *recorder) note(name string) {
+	r.got = append(r.got, name)
+}
+
+// hit returns a callback noting name.
+func (r *recorder) hit(name string) func(Event) {
+	return func(Event) { r.note(name) }
+}
+
+// run calls f and returns what was noted meanwhile.
+func (r *recorder) run(f func()) []string {
+	r.got = nil
+	f()
+	return r.got
+}
+
+func TestGestures(t *testing.T) {
+	clock := &fakeClock{now: time.Unix(1e9, 0)}
+	g := NewGestures(GestureOptions{Clock: clock})
+
+	rec := &recorder{}
+	tt.Nil(t, g.OnTap("shift", rec.hit("tap")))
+	tt.Nil(t, g.OnDoubleTap("shift", 300*time.Millisecond, rec.hit("double")))
+	tt.Nil(t, g.OnLongPress("a", 300*time.Millisecond, rec.hit("long")))
+	tt.Equal(t, true, errors.Is(g.OnTap("nope", rec.hit("")), ErrUnknownKey))
+
+	key := func(kind uint8, name string) {
+		g.Feed(Event{Kind: kind, Keycode: Keycode[name], When: clock.Now()})
+	}
+	tap := func(name string) {
+		key(KeyDown, name)
+		clock.Advance(50 * time.Millisecond)
+		key(KeyUp, name)
+	}
+
+	tt.Equal(t, []string{"tap"}, rec.run(func() { tap("shift") }))
+	tt.Equal(t, []string{"tap", "double"}, rec.run(func() {
+		clock.Advance(100 * time.Millisecond)
+		tap("shift")
+	}))
+	// Too slow for a double tap, and right shift counts as shift too.
+	tt.Equal(t, []string{"tap", "tap"}, rec.run(func() {
+		clock.Advance(time.Second)
+		tap("shiftr")
+		clock.Advance(time.Second)
+		tap("shift")
+	}))
+
+	// Shift+A is not a tap of shift.
+	tt.Equal(t, 0, len(rec.run(func() {
+		key(KeyDown, "shift")
+		tap("a")
+		key(KeyUp, "shift")
+	})))
+
+	tt.Equal(t, []string{"long"}, rec.run(func() {
+		key(KeyDown, "a")
+		key(KeyDown, "a") // auto-repeat
+		clock.Advance(299 * time.Millisecond)
+		tt.Equal(t, 0, len(rec.got))
+		clock.Advance(time.Millisecond)
+		key(KeyUp, "a")
+	}))
+	// Another key pressed meanwhile cancels the long press.
+	tt.Equal(t, 0, len(rec.run(func() {
+		key(KeyDown, "a")
+		g.Feed(Event{Kind: MouseDown, Button: MouseMap["left"]})
+		clock.Advance(time.Second)
+		key(KeyUp, "a")
+	})))
+}
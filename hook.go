@@ -11,9 +11,15 @@
 package hook
 
 import (
+	"context"
 	"fmt"
+	"maps"
 	"runtime"
+	"slices"
+	"strconv"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -37,6 +43,7 @@ const (
 	MouseDrag  = 10
 	MouseWheel = 11
 
+	// FakeEvent is never reported; injected events carry Event.Synthetic.
 	FakeEvent = 12
 
 	// Keychar could be v
@@ -45,6 +52,57 @@ const (
 	WheelDown     = 1
 )
 
+// Event.Mask modifier and button bits, as in libuiohook (hook/iohook.h
+// MASK_*). The pure-Go backends fill Event.Mask with the same bits.
+const (
+	maskShiftL uint16 = 1 << 0
+	maskCtrlL  uint16 = 1 << 1
+	maskMetaL  uint16 = 1 << 2
+	maskAltL   uint16 = 1 << 3
+	maskShiftR uint16 = 1 << 4
+	maskCtrlR  uint16 = 1 << 5
+	maskMetaR  uint16 = 1 << 6
+	maskAltR   uint16 = 1 << 7
+
+	maskButton1 uint16 = 1 << 8
+	maskButton2 uint16 = 1 << 9
+	maskButton3 uint16 = 1 << 10
+	maskButton4 uint16 = 1 << 11
+	maskButton5 uint16 = 1 << 12
+
+	maskNumLock    uint16 = 1 << 13
+	maskCapsLock   uint16 = 1 << 14
+	maskScrollLock uint16 = 1 << 15
+
+	maskShift = maskShiftL | maskShiftR
+	maskCtrl  = maskCtrlL | maskCtrlR
+	maskMeta  = maskMetaL | maskMetaR
+	maskAlt   = maskAltL | maskAltR
+
+	maskButtons = maskButton1 | maskButton2 | maskButton3 | maskButton4 | maskButton5
+)
+
+// Event.Direction of a MouseWheel event (iohook.h WHEEL_*_DIRECTION).
+const (
+	wheelVertical   uint8 = 3
+	wheelHorizontal uint8 = 4
+)
+
+// Source tells who injected a synthetic event, see Event.Source.
+type Source uint8
+
+// Event sources.
+const (
+	// SourceDevice is input from a device, or from an injector the backend
+	// cannot tell apart from one.
+	SourceDevice Source = iota
+	// SourceOther is input injected by another program.
+	SourceOther
+	// SourceSelf is input injected by this process through Post, or on
+	// the pure-Go macOS backend by any means.
+	SourceSelf
+)
+
 // Event Holds a system event
 //
 // If it's a Keyboard event the relevant fields are:
@@ -54,8 +112,18 @@ const (
 // If it's a Mouse event the relevant fields are:
 // Button, Clicks, X, Y, Amount, Rotation and Direction
 type Event struct {
-	Kind     uint8 `json:"id"`
-	When     time.Time
+	Kind uint8 `json:"id"`
+	// When is the time of the event, taken from OSTime when the backend
+	// has one and from the time the backend sent it otherwise.
+	When time.Time
+	// OSTime is the backend's own timestamp of the event, with its own
+	// unit and epoch: X server milliseconds on X11, Wayland event
+	// milliseconds, tick count milliseconds on Windows and
+	// mach_absolute_time ticks on macOS. It is 0 for events with none.
+	OSTime uint64 `json:"time"`
+	// Seq numbers the events in the order the backend sent them.
+	Seq uint64 `json:"seq"`
+
 	Mask     uint16 `json:"mask"`
 	Reserved uint16 `json:"reserved"`
 
@@ -72,24 +140,845 @@ type Event struct {
 	Amount    uint16 `json:"amount"`
 	Rotation  int32  `json:"rotation"`
 	Direction uint8  `json:"direction"`
+
+	// Synthetic reports input injected by software (XTEST, SendInput,
+	// CGEventPost, Post) rather than typed or clicked on a device, as far
+	// as the backend can tell. Source tells who injected it.
+	//
+	// The cgo backend cannot tell who injected an event, and never reports
+	// SourceOther. It guesses SourceSelf instead: an event of the kind and
+	// key, button or position of one Post sent within the last second is
+	// taken to be that one. A device event matching a pending post is
+	// therefore tagged SourceSelf in its place, and the posted event then
+	// comes back as SourceDevice.
+	Synthetic bool   `json:"synthetic"`
+	Source    Source `json:"source"`
+
+	// Samples is the number of pointer samples a MouseMove or MouseDrag
+	// stands for, more than 1 when the Hook merged them (see
+	// Options.Motion), and DX, DY how far they moved the pointer since the
+	// Hook's previous motion event.
+	Samples uint16 `json:"samples"`
+	DX      int32  `json:"dx"`
+	DY      int32  `json:"dy"`
+
+	// Gap reports that the Hook dropped events before this one (see
+	// Options.Policy), so key and button state tracked from the earlier
+	// events may be stale.
+	Gap bool `json:"gap"`
+}
+
+// Options configures a Hook created by New.
+type Options struct {
+	// Buffer is the capacity of the Hook's event channel (1024 when zero).
+	Buffer int
+
+	// Kinds are the event kinds the Hook receives, such as KeyDown or
+	// MouseMove; all of them when empty. HookEnabled and HookDisabled are
+	// always delivered. The backend subscribes only to the kinds the
+	// running Hooks want, so a keyboard-only Hook does not pay for pointer
+	// motion. Hotkeys need KeyDown and KeyUp.
+	//
+	// Hooks running at the same time share the backend, which delivers the
+	// union of their kinds, narrowing it as they end. A Hook joining with
+	// kinds the backend fails to add gets HookDisabled, and StartContext
+	// returns the error.
+	Kinds []uint8
+
+	// Motion is how the Hook reports pointer motion, MotionAll by default.
+	// Under every policy motion takes at most three quarters of the
+	// channel, merging beyond that, so key and button events keep room.
+	Motion MotionPolicy
+	// MotionRate is the most motion events per second under
+	// MotionThrottle (60 when zero).
+	MotionRate int
+
+	// Policy is what the Hook does with an event when its channel is full,
+	// DropNewest by default. Dropped counts the events lost and the next
+	// event delivered has Gap set.
+	Policy BufferPolicy
+	// BlockTimeout is how long the Block policy waits for room (100ms when
+	// zero).
+	BlockTimeout time.Duration
+}
+
+// BufferPolicy is how a Hook handles a full channel, see Options.Policy.
+type BufferPolicy uint8
+
+const (
+	// DropNewest drops the event that does not fit.
+	DropNewest BufferPolicy = iota
+	// DropOldest drops the oldest unread event to make room.
+	DropOldest
+	// Block waits up to Options.BlockTimeout for room, then drops the
+	// event. The wait happens on a goroutine of the Hook, never on the
+	// backend's thread: up to Options.Buffer more events queue behind the
+	// one waiting, and an event arriving when that queue is full is dropped.
+	Block
+)
+
+const defaultBlockTimeout = 100 * time.Millisecond
+
+// kindSet is a set of event kinds, one bit per kind.
+type kindSet uint32
+
+const (
+	allKinds = ^kindSet(0)
+
+	keyKinds    = kindSet(1<<KeyDown | 1<<KeyHold | 1<<KeyUp)
+	buttonKinds = kindSet(1<<MouseDown | 1<<MouseHold | 1<<MouseUp | 1<<MouseWheel)
+	motionKinds = kindSet(1<<MouseMove | 1<<MouseDrag)
+)
+
+// kindsOf returns the set of kinds, all of them when kinds is empty.
+func kindsOf(kinds []uint8) kindSet {
+	if len(kinds) == 0 {
+		return allKinds
+	}
+
+	s := kindSet(1<<HookEnabled | 1<<HookDisabled)
+	for _, k := range kinds {
+		if k < 32 {
+			s |= 1 << k
+		}
+	}
+	return s
+}
+
+// has reports whether kind is in the set.
+func (s kindSet) has(kind uint8) bool {
+	return kind < 32 && s&(1<<kind) != 0
+}
+
+// State is the lifecycle state of a Hook.
+type State uint32
+
+// Hook lifecycle states. A Hook moves Idle -> Starting -> Running ->
+// Stopping -> Stopped, and may be started again from Stopped.
+const (
+	Idle State = iota
+	Starting
+	Running
+	Stopping
+	Stopped
+)
+
+// String returns the state name.
+func (s State) String() string {
+	switch s {
+	case Idle:
+		return "Idle"
+	case Starting:
+		return "Starting"
+	case Running:
+		return "Running"
+	case Stopping:
+		return "Stopping"
+	case Stopped:
+		return "Stopped"
+	}
+
+	return "State(" + strconv.Itoa(int(s)) + ")"
+}
+
+// Hook is an independent event listener with its own event channel, hotkey
+// registry and Start/End lifecycle.
+//
+// The OS-level hook itself is shared: the backend is started by the first
+// running Hook and stopped by the last one, and every running Hook receives
+// its own copy of each event. The package-level Start, End, Register and
+// Process functions operate on a default Hook.
+type Hook struct {
+	opts  Options
+	kinds kindSet
+	clock Clock
+
+	// mu guards the lifecycle fields. push() holds it for reading while it
+	// delivers, so End() can close ev once no delivery is in flight.
+	mu      sync.RWMutex
+	state   State
+	ev      chan Event
+	started chan error    // backend start result, see StartContext
+	done    chan struct{} // closed once End has finished the teardown
+	blocked *blockQueue   // the events waiting for room, under Block
+
+	// regMu serializes registry writers; Process reads reg lock-free.
+	regMu sync.Mutex
+	reg   atomic.Pointer[registry]
+
+	motion motionState
+
+	// dropped counts the events lost; gap marks the next one delivered.
+	dropped atomic.Uint64
+	gap     atomic.Bool
+
+	// pressed are the keys Process sees held, for Snapshot.
+	pressed atomic.Pointer[[]uint16]
+}
+
+// binding is one registered callback. Only its off and match flags change
+// after the binding has been published in a registry.
+type binding struct {
+	when   uint8
+	name   string
+	keys   []uint16
+	upkeys []uint16
+	mods   Modifier
+	// buttons are the mouse buttons to hold, as Event.Mask bits, and wheel
+	// the wheel direction that triggers the binding.
+	buttons uint16
+	wheel   uint8
+	cb      func(Event)
+	off     atomic.Bool
+	match   atomic.Uint32
+
+	// seq is set for a RegisterSequence binding.
+	seq     []Hotkey
+	timeout time.Duration
+
+	// release drops the grab of a RegisterGrab binding.
+	release func()
+
+	// calls and busy count the callback runs and their total time.
+	calls atomic.Uint64
+	busy  atomic.Int64
+}
+
+// registry is an immutable snapshot of a Hook's bindings, indexed by the
+// event kind that triggers them. Writers publish a modified copy, so
+// dispatch never takes a lock and never sees a half-applied change.
+type registry struct {
+	events map[uint8][]*binding
+
+	// seqs are the key sequences, and root their prefix tree.
+	seqs     []*binding
+	root     *seqNode
+	onPrefix func([]Hotkey)
+	onAbort  func([]Hotkey)
+}
+
+// Binding is a handle to a callback registered with Register. The zero
+// Binding is valid and its methods do nothing.
+type Binding struct {
+	h *Hook
+	b *binding
 }
 
 var (
-	ev      = make(chan Event, 1024)
-	asyncon = false
+	// asyncon reports whether the shared OS-level backend is running.
+	asyncon atomic.Bool
 
 	lck sync.RWMutex
 
-	pressed   = make(map[uint16]bool, 256)
-	uppressed = make(map[uint16]bool, 256)
-	used      = []int{}
+	// backendMu serializes starting and stopping the shared backend, so a
+	// new session never overlaps the teardown of the previous one.
+	backendMu sync.Mutex
+
+	// hookMu guards the session below. hooks is replaced, never modified in
+	// place, so send() can range over a snapshot without holding the lock.
+	hookMu   sync.Mutex
+	hooks    []*Hook
+	enabled  bool
+	startErr error
+	up       chan struct{} // closed once the backend is enabled or failed
+	down     chan struct{} // closed once runBackend has returned
+
+	// wanted is the kindSet the backend subscribes to: the union of the
+	// kinds of the attached Hooks.
+	wanted atomic.Uint32
 
-	keys   = map[int][]uint16{}
-	upkeys = map[int][]uint16{}
-	cbs    = map[int]func(Event){}
-	events = map[uint8][]int{}
+	// eventSeq numbers the events send delivers.
+	eventSeq atomic.Uint64
+
+	std = New(Options{})
 )
 
+// New returns a new, idle Hook.
+func New(opts Options) *Hook {
+	h := &Hook{opts: opts, kinds: kindsOf(opts.Kinds), clock: systemClock{},
+		done: make(chan struct{})}
+	close(h.done)
+	h.resetState()
+	return h
+}
+
+// Start starts the default Hook, see Hook.Start.
+func Start(tm ...int) chan Event {
+	return std.Start(tm...)
+}
+
+// End ends the default Hook, see Hook.End.
+func End(tm ...int) {
+	std.End(tm...)
+}
+
+// Dropped returns the default Hook's lost event count, see Hook.Dropped.
+func Dropped() uint64 {
+	return std.Dropped()
+}
+
+// Done returns the default Hook's teardown channel, see Hook.Done.
+func Done() <-chan struct{} {
+	return std.Done()
+}
+
+// Register registers a callback on the default Hook, see Hook.Register.
+func Register(when uint8, cmds []string, cb func(Event)) (Binding, error) {
+	return std.Register(when, cmds, cb)
+}
+
+// Process runs the default Hook's registered callbacks, see Hook.Process.
+func Process(evChan <-chan Event) (out chan bool) {
+	return std.Process(evChan)
+}
+
+// StartContext starts the default Hook, see Hook.StartContext.
+func StartContext(ctx context.Context, tm ...int) (<-chan Event, error) {
+	return std.StartContext(ctx, tm...)
+}
+
+// Start adds the global event hook to the OS (or joins it when another Hook
+// is already running) and returns this Hook's event channel. Starting a
+// running Hook returns its current channel; starting a stopping Hook waits
+// for the teardown to finish first.
+//
+// The optional argument was the CGo backend's poll interval in
+// milliseconds. Every backend is now event-driven and ignores it.
+func (h *Hook) Start(tm ...int) chan Event {
+	s, _ := h.start(tm...)
+	return s
+}
+
+// start is Start, also reporting whether this call started the Hook.
+func (h *Hook) start(tm ...int) (chan Event, bool) {
+	size := h.opts.Buffer
+	if size <= 0 {
+		size = 1024
+	}
+
+	h.mu.Lock()
+	switch h.state {
+	case Starting, Running:
+		s := h.ev
+		h.mu.Unlock()
+		return s, false
+	case Stopping:
+		done := h.done
+		h.mu.Unlock()
+		<-done
+		return h.start(tm...)
+	}
+
+	h.state = Starting
+	h.ev = make(chan Event, size)
+	h.blocked = nil
+	if h.opts.Policy == Block {
+		h.blocked = h.newBlockQueue()
+	}
+	h.started = make(chan error, 1)
+	h.done = make(chan struct{})
+	h.motion.reset()
+	h.gap.Store(false)
+	s := h.ev
+	h.mu.Unlock()
+
+	attach(h, tm...)
+	return s, true
+}
+
+// StartContext starts the Hook like Start, but blocks until the backend
+// reports HookEnabled or fails. A failure is returned as one of the Err*
+// errors (test with errors.Is) and the Hook is ended. Cancelling ctx, before
+// or after the backend is enabled, ends the Hook and closes its channel.
+//
+// A Hook that is already starting or running is left alone, and
+// StartContext returns ErrAlreadyRunning.
+func (h *Hook) StartContext(ctx context.Context, tm ...int) (<-chan Event, error) {
+	s, ok := h.start(tm...)
+	if !ok {
+		return nil, ErrAlreadyRunning
+	}
+
+	h.mu.RLock()
+	started, done := h.started, h.done
+	h.mu.RUnlock()
+
+	select {
+	case err := <-started:
+		if err != nil {
+			h.End()
+			return nil, err
+		}
+	case <-ctx.Done():
+		h.End()
+		return nil, ctx.Err()
+	}
+
+	go func() {
+		select {
+		case <-ctx.Done():
+			h.End()
+		case <-done:
+		}
+	}()
+
+	return s, nil
+}
+
+// End detaches this Hook from the global event hook, closes its channel and
+// resets its registry. The OS-level hook is removed when the last running
+// Hook ends, and End returns only after the backend has actually exited.
+// A backend still starting is not waited for: it is stopped once it is
+// enabled or fails, and the next Start waits for that.
+//
+// End is safe to call concurrently and repeatedly: a second call waits for
+// the teardown in progress, and ending an idle or stopped Hook is a no-op.
+// The optional argument is accepted for backward compatibility and ignored.
+func (h *Hook) End(tm ...int) {
+	_ = tm
+
+	h.mu.Lock()
+	switch h.state {
+	case Idle, Stopped:
+		h.mu.Unlock()
+		return
+	case Stopping:
+		done := h.done
+		h.mu.Unlock()
+		<-done
+		return
+	}
+
+	h.state = Stopping
+	done, q := h.done, h.blocked
+	h.mu.Unlock()
+
+	detach(h)
+	if q != nil {
+		q.stop()
+	}
+
+	h.mu.Lock()
+	close(h.ev)
+	h.state = Stopped
+	h.mu.Unlock()
+
+	h.resetState()
+	close(done)
+}
+
+// State returns the Hook's lifecycle state.
+func (h *Hook) State() State {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return h.state
+}
+
+// Done returns a channel that is closed once the current (or most recent)
+// run of the Hook has been torn down by End. It is already closed for a Hook
+// that was never started.
+func (h *Hook) Done() <-chan struct{} {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return h.done
+}
+
+// attach adds h to the running hooks, starting the backend for the first
+// one. A Hook joining an already enabled backend gets its own HookEnabled.
+// A Hook whose kinds the running backend cannot subscribe to fails to
+// start, with a HookDisabled event.
+func attach(h *Hook, tm ...int) {
+	backendMu.Lock()
+	defer backendMu.Unlock()
+
+	hookMu.Lock()
+	first := len(hooks) == 0
+	w := kindSet(wanted.Load())
+	grow := !first && w|h.kinds != w
+	switch {
+	case first:
+		wanted.Store(uint32(h.kinds))
+	case grow:
+		wanted.Store(uint32(w | h.kinds))
+	}
+	hookMu.Unlock()
+
+	// wanted is stored first, so a backend still starting subscribes to it
+	// itself if subscribe finds no backend to change yet.
+	if first || grow {
+		if err := subscribe(kindSet(wanted.Load())); err != nil {
+			wanted.Store(uint32(w))
+			h.signal(err)
+			h.push(Event{Kind: HookDisabled, When: time.Now()})
+			return
+		}
+	}
+
+	hookMu.Lock()
+	hs := make([]*Hook, 0, len(hooks)+1)
+	hooks = append(append(hs, hooks...), h)
+
+	switch {
+	case first:
+		metrics.sessions.Add(1)
+		osTime.reset()
+		enabled = false
+		startErr = nil
+		up = make(chan struct{})
+		down = make(chan struct{})
+		asyncon.Store(true)
+	case startErr != nil:
+		h.signal(startErr)
+	case enabled:
+		h.signal(nil)
+		h.push(Event{Kind: HookEnabled, When: time.Now()})
+	}
+	u, d := up, down
+	hookMu.Unlock()
+
+	if !first {
+		return
+	}
+
+	go func() {
+		runBackend(tm...)
+
+		// A backend that returns without reporting either way has failed.
+		select {
+		case <-u:
+		default:
+			fail(ErrBackend)
+		}
+		close(d)
+	}()
+}
+
+// detach removes h from the running hooks. After the last one it stops the
+// backend and waits for runBackend to return.
+func detach(h *Hook) {
+	backendMu.Lock()
+
+	hookMu.Lock()
+	hs := make([]*Hook, 0, len(hooks))
+	for _, o := range hooks {
+		if o != h {
+			hs = append(hs, o)
+		}
+	}
+	last := len(hs) != len(hooks) && len(hs) == 0
+	hooks = hs
+	u, d := up, down
+
+	var k kindSet
+	for _, o := range hs {
+		k |= o.kinds
+	}
+	narrow := !last && k != kindSet(wanted.Load())
+	if narrow {
+		wanted.Store(uint32(k))
+	}
+	hookMu.Unlock()
+
+	if !last {
+		// Failing to narrow only costs the events send drops.
+		if narrow {
+			subscribe(k)
+		}
+		backendMu.Unlock()
+		return
+	}
+
+	// Let an in-flight start settle first, so stopBackend finds whatever
+	// the backend has to tear down. A start that is still running may never
+	// settle: stop it in the background, holding backendMu so the next
+	// session waits for it.
+	select {
+	case <-u:
+		stopSession(d)
+		backendMu.Unlock()
+	default:
+		go func() {
+			<-u
+			stopSession(d)
+			backendMu.Unlock()
+		}()
+	}
+}
+
+// stopSession stops the settled backend and waits for runBackend to
+// close d.
+func stopSession(d chan struct{}) {
+	asyncon.Store(false)
+	stopBackend()
+	<-d
+
+	hookMu.Lock()
+	enabled = false
+	hookMu.Unlock()
+}
+
+// settle marks the session start as finished; hookMu must be held.
+func settle() {
+	select {
+	case <-up:
+	default:
+		close(up)
+	}
+}
+
+// send timestamps an event and fans it out to every running Hook. It is
+// called by the backends from their event threads and never blocks them.
+func send(e Event) {
+	if !asyncon.Load() || !kindSet(wanted.Load()).has(e.Kind) {
+		return
+	}
+	metrics.events[e.Kind].Add(1)
+
+	now := time.Now()
+	e.When = now
+	if e.OSTime != 0 {
+		e.When = osTime.when(e.OSTime, now)
+	}
+	e.Seq = eventSeq.Add(1)
+
+	hookMu.Lock()
+	switch e.Kind {
+	case HookEnabled:
+		enabled = true
+		settle()
+	case HookDisabled:
+		enabled = false
+	}
+	hs := hooks
+	hookMu.Unlock()
+
+	for _, h := range hs {
+		if e.Kind == HookEnabled {
+			h.signal(nil)
+		}
+		h.push(e)
+	}
+}
+
+// lose is called by a backend that dropped n events before send: every
+// running Hook has lost them.
+func lose(n uint64) {
+	hookMu.Lock()
+	hs := hooks
+	hookMu.Unlock()
+
+	for _, h := range hs {
+		h.lose(n)
+	}
+}
+
+// fail is called by a backend that could not start (or lost its connection):
+// it reports err to every Hook waiting in StartContext and sends
+// HookDisabled.
+func fail(err error) {
+	hookMu.Lock()
+	startErr = err
+	settle()
+	hs := hooks
+	hookMu.Unlock()
+
+	for _, h := range hs {
+		h.signal(err)
+	}
+	send(Event{Kind: HookDisabled})
+}
+
+// signal reports the backend start result to StartContext and moves a
+// starting Hook to Running; only the first result after Start is kept.
+func (h *Hook) signal(err error) {
+	h.mu.Lock()
+	if err == nil && h.state == Starting {
+		h.state = Running
+	}
+	started := h.started
+	h.mu.Unlock()
+
+	select {
+	case started <- err:
+	default:
+	}
+}
+
+// push delivers an event to this Hook's channel, dropping it if the buffer
+// is full or the Hook is no longer running. Pointer motion goes through the
+// Hook's MotionPolicy.
+func (h *Hook) push(e Event) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	if h.state != Starting && h.state != Running || !h.kinds.has(e.Kind) {
+		return
+	}
+
+	if e.Kind == MouseMove || e.Kind == MouseDrag {
+		h.pushMotion(e)
+		return
+	}
+	h.flushMotion()
+	h.deliver(e)
+}
+
+// deliver puts e on the channel under the Hook's BufferPolicy; h.mu must
+// be held for reading.
+func (h *Hook) deliver(e Event) {
+	if h.offer(e) {
+		return
+	}
+
+	switch h.opts.Policy {
+	case DropOldest:
+		select {
+		case <-h.ev:
+			h.lose(1)
+		default:
+		}
+		if h.offer(e) {
+			return
+		}
+	case Block:
+		if h.blocked.add(e, cap(h.ev)) {
+			return
+		}
+	}
+	h.lose(1)
+}
+
+// offer puts e on the channel if it has room, marking it if events were
+// lost before it. Under Block, events waiting for room go first.
+func (h *Hook) offer(e Event) bool {
+	if q := h.blocked; q != nil {
+		q.mu.Lock()
+		defer q.mu.Unlock()
+		if len(q.evs) > 0 {
+			return false
+		}
+	}
+
+	e.Gap = h.gap.Swap(false)
+	select {
+	case h.ev <- e:
+		metrics.fill(len(h.ev))
+		return true
+	default:
+		if e.Gap {
+			h.gap.Store(true)
+		}
+		return false
+	}
+}
+
+// blockQueue holds the events of a Block Hook that found its channel full,
+// and feeds them to the channel from its own goroutine.
+type blockQueue struct {
+	mu   sync.Mutex
+	evs  []Event
+	wake chan struct{}
+	quit chan struct{}
+	done chan struct{}
+}
+
+// newBlockQueue starts feeding h's channel; h.mu must be held.
+func (h *Hook) newBlockQueue() *blockQueue {
+	q := &blockQueue{wake: make(chan struct{}, 1), quit: make(chan struct{}),
+		done: make(chan struct{})}
+
+	d := h.opts.BlockTimeout
+	if d <= 0 {
+		d = defaultBlockTimeout
+	}
+	go h.feedBlocked(q, h.ev, d)
+	return q
+}
+
+// add queues e, unless n events are already waiting.
+func (q *blockQueue) add(e Event, n int) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if len(q.evs) >= n {
+		return false
+	}
+	q.evs = append(q.evs, e)
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+	return true
+}
+
+// stop ends the feeding goroutine, dropping the events still queued.
+func (q *blockQueue) stop() {
+	close(q.quit)
+	<-q.done
+}
+
+// feedBlocked sends the queued events to ev in order, each waiting up to d
+// for room.
+func (h *Hook) feedBlocked(q *blockQueue, ev chan Event, d time.Duration) {
+	defer close(q.done)
+
+	t := time.NewTimer(d)
+	t.Stop()
+	for {
+		q.mu.Lock()
+		if len(q.evs) == 0 {
+			q.mu.Unlock()
+			select {
+			case <-q.wake:
+				continue
+			case <-q.quit:
+				return
+			}
+		}
+		// The event stays queued while it waits, so offer keeps the order.
+		e := q.evs[0]
+		q.mu.Unlock()
+
+		e.Gap = h.gap.Swap(false)
+		t.Reset(d)
+		select {
+		case ev <- e:
+			metrics.fill(len(ev))
+		case <-t.C:
+			if e.Gap {
+				h.gap.Store(true)
+			}
+			h.lose(1)
+		case <-q.quit:
+			return
+		}
+		t.Stop()
+
+		q.mu.Lock()
+		q.evs = q.evs[1:]
+		q.mu.Unlock()
+	}
+}
+
+// lose counts n events lost by the Hook.
+func (h *Hook) lose(n uint64) {
+	h.dropped.Add(n)
+	metrics.dropped.Add(n)
+	h.gap.Store(true)
+}
+
+// Dropped returns the number of events the Hook has lost since it was
+// created, because its channel was full or the backend could not keep up.
+func (h *Hook) Dropped() uint64 {
+	return h.dropped.Load()
+}
+
+// ending reports whether End has been called on the Hook.
+func (h *Hook) ending() bool {
+	s := h.State()
+	return s == Stopping || s == Stopped
+}
+
 func allPressed(pressed map[uint16]bool, keys ...uint16) bool {
 	for _, i := range keys {
 		// fmt.Println(i)
@@ -114,61 +1003,245 @@ func keyRegistered(evKeyCode uint16, keys ...uint16) bool {
 	return false
 }
 
-// Register register gohook event
-func Register(when uint8, cmds []string, cb func(Event)) {
-	key := len(used)
-	used = append(used, key)
+// triggers reports whether an event can fire the binding: its key or
+// button is one of the binding's keys, modifiers or buttons, or the wheel
+// turns the binding's way, or the binding names nothing at all.
+func (b *binding) triggers(ev Event) bool {
+	if b.wheel != 0 {
+		return wheelOf(ev) == b.wheel
+	}
+	if ev.Kind == MouseDown || ev.Kind == MouseHold || ev.Kind == MouseUp {
+		if buttonMask(ev.Button)&b.buttons != 0 {
+			return true
+		}
+	}
+
+	if m := modCodes[ev.Keycode]; m&b.mods != 0 {
+		return true
+	}
+	if len(b.keys) == 0 {
+		return b.mods == 0 && b.buttons == 0
+	}
+	return keyRegistered(ev.Keycode, b.keys...)
+}
+
+// Register registers cb to run when an event of kind when arrives while all
+// the keys named in cmds are pressed. It returns a Binding to disable or
+// remove the callback later, or an error wrapping ErrUnknownKey when a name
+// is not in Keycode. Register and the Binding methods are safe to call while
+// Process is running.
+//
+// Modifier names match either side: "ctrl" is left or right Ctrl. Prefix
+// them with l or r for one side, as in "rctrl" or "lalt"; Keycode's "shiftr",
+// "altr" and "cmdr" also mean the right-hand key. The mouse tokens of
+// AddEvent join keys and modifiers: "mleft", "mright", "center", "mback" and
+// "mforward" are buttons to hold, and "wheelUp", "wheelDown", "wheelLeft"
+// and "wheelRight" fire a MouseWheel binding. A binding naming no key at
+// all fires on every event of its kind. The binding matches in Subset
+// mode: it also fires while other modifiers are held. Use
+// Binding.SetMatch(Exact) to change that.
+func (h *Hook) Register(when uint8, cmds []string, cb func(Event)) (Binding, error) {
+	return h.register(when, strings.Join(cmds, "+"), cmds, Subset, cb)
+}
+
+// register adds a binding for cmds, reported as name by Metrics and
+// Snapshot.
+func (h *Hook) register(when uint8, name string, cmds []string, m Match, cb func(Event)) (Binding, error) {
+	b, err := newBinding(when, name, cmds, m, cb)
+	if err != nil {
+		return Binding{}, err
+	}
+	return h.publish(b), nil
+}
+
+// newBinding returns the binding register adds, not yet published.
+func newBinding(when uint8, name string, cmds []string, m Match, cb func(Event)) (*binding, error) {
 	tmp := []uint16{}
 	uptmp := []uint16{}
+	var mods Modifier
+	var buttons uint16
+	var wheel uint8
 
 	for _, v := range cmds {
+		if mod, ok := modAlias[v]; ok {
+			mods |= mod
+			continue
+		}
+		if m, ok := mouseTokens[v]; ok {
+			buttons |= buttonMask(m.button)
+			if m.wheel != 0 {
+				wheel = m.wheel
+			}
+			continue
+		}
+
+		code, ok := Keycode[v]
+		if !ok {
+			return nil, fmt.Errorf("%w %q", ErrUnknownKey, v)
+		}
+
 		if when == KeyUp {
-			uptmp = append(uptmp, Keycode[v])
+			uptmp = append(uptmp, code)
 		}
-		tmp = append(tmp, Keycode[v])
+		tmp = append(tmp, code)
 	}
 
-	keys[key] = tmp
-	upkeys[key] = uptmp
-	cbs[key] = cb
-	events[when] = append(events[when], key)
-	// return
+	b := &binding{when: when, name: name, keys: tmp, upkeys: uptmp, mods: mods,
+		buttons: buttons, wheel: wheel, cb: cb}
+	b.match.Store(uint32(m))
+	return b, nil
 }
 
-// Process return go hook process
-func Process(evChan <-chan Event) (out chan bool) {
+// publish adds b to the registry, from where Process runs it.
+func (h *Hook) publish(b *binding) Binding {
+	h.update(func(r *registry) {
+		r.events[b.when] = append(slices.Clip(r.events[b.when]), b)
+	})
+	return Binding{h: h, b: b}
+}
+
+// update publishes a copy of the registry modified by fn.
+func (h *Hook) update(fn func(r *registry)) {
+	h.regMu.Lock()
+	defer h.regMu.Unlock()
+
+	r := *h.reg.Load()
+	r.events = maps.Clone(r.events)
+	fn(&r)
+	h.reg.Store(&r)
+}
+
+// Unregister removes the callback from its Hook.
+func (b Binding) Unregister() {
+	if b.h == nil {
+		return
+	}
+	if b.b.release != nil {
+		b.b.release()
+	}
+
+	b.h.update(func(r *registry) {
+		if b.b.seq != nil {
+			r.seqs = slices.DeleteFunc(slices.Clone(r.seqs),
+				func(o *binding) bool { return o == b.b })
+			r.root = seqTree(r.seqs)
+			return
+		}
+
+		r.events[b.b.when] = slices.DeleteFunc(slices.Clone(r.events[b.b.when]),
+			func(o *binding) bool { return o == b.b })
+	})
+}
+
+// Disable keeps the callback registered but stops it from firing.
+func (b Binding) Disable() {
+	if b.b != nil {
+		b.b.off.Store(true)
+	}
+}
+
+// Enable lets a disabled callback fire again.
+func (b Binding) Enable() {
+	if b.b != nil {
+		b.b.off.Store(false)
+	}
+}
+
+// SetMatch sets how the callback compares the held modifiers with its own.
+func (b Binding) SetMatch(m Match) {
+	if b.b != nil {
+		b.b.match.Store(uint32(m))
+	}
+}
+
+// Process runs the registered callbacks for the events read from evChan,
+// and signals out once evChan is closed. The pressed-key state belongs to
+// the Process goroutine; the registry is read from lock-free snapshots.
+func (h *Hook) Process(evChan <-chan Event) (out chan bool) {
 	out = make(chan bool)
 	go func() {
-		for ev := range evChan {
+		pressed := make(map[uint16]bool, 256)
+		uppressed := make(map[uint16]bool, 256)
+		var upheld Modifier
+		var buttons, upbuttons uint16
+		var seq seqState
+		defer seq.reset()
+
+		for {
+			var ev Event
+			var ok bool
+			select {
+			case ev, ok = <-evChan:
+			case <-seq.expired():
+				seq.abort(h.reg.Load())
+				continue
+			}
+			if !ok {
+				break
+			}
+
+			repeat := false
 			switch ev.Kind {
 			case KeyDown, KeyHold:
-				pressed[ev.Keycode] = true
+				if repeat = pressed[ev.Keycode]; !repeat {
+					pressed[ev.Keycode] = true
+					h.setPressed(pressed)
+				}
 				uppressed[ev.Keycode] = true
 			case KeyUp:
-				pressed[ev.Keycode] = false
+				if pressed[ev.Keycode] {
+					pressed[ev.Keycode] = false
+					h.setPressed(pressed)
+				}
+			case MouseDown:
+				buttons |= buttonMask(ev.Button)
+				upbuttons |= buttonMask(ev.Button)
+			case MouseHold, MouseUp:
+				// libuiohook and the Windows backend release a button with
+				// MouseHold, and follow it with MouseUp unless it dragged;
+				// the other backends only send MouseUp.
+				buttons &^= buttonMask(ev.Button)
 			}
+			held := heldMods(pressed, ev.Mask)
+			upheld |= held
+			btns := buttons | ev.Mask&maskButtons
 
-			for _, v := range events[ev.Kind] {
-				if !asyncon {
+			r := h.reg.Load()
+			if ev.Kind == KeyDown && !h.ending() && seq.feed(r, ev, held, repeat) {
+				continue
+			}
+
+			for _, b := range r.events[ev.Kind] {
+				if h.ending() {
 					break
 				}
-				if keyRegistered(ev.Keycode, keys[v]...) {
+				if b.off.Load() {
+					continue
+				}
+				// Only the keys of a combo trigger it, not every other
+				// key pressed while the combo is held.
+				if !b.triggers(ev) {
 					continue
 				}
+				m := Match(b.match.Load())
 
-				if allPressed(pressed, keys[v]...) {
-					cbs[v](ev)
-				} else if ev.Kind == KeyUp {
+				if allPressed(pressed, b.keys...) && modsMatch(held, b.mods, m) &&
+					btns&b.buttons == b.buttons {
+					b.run(ev)
+				} else if ev.Kind == KeyUp || ev.Kind == MouseHold || ev.Kind == MouseUp {
 					//uppressed[ev.Keycode] = true
-					if allPressed(uppressed, upkeys[v]...) {
+					if allPressed(uppressed, b.upkeys...) && modsMatch(upheld, b.mods, m) &&
+						upbuttons&b.buttons == b.buttons {
 						uppressed = make(map[uint16]bool, 256)
-						cbs[v](ev)
+						upheld, upbuttons = 0, 0
+						b.run(ev)
 					}
 				}
 			}
 		}
 
 		// fmt.Println("exiting after end (process)")
+		h.pressed.Store(nil)
 		out <- true
 	}()
 
@@ -243,14 +1316,9 @@ func KeycharToRawcode(kc string) uint16 {
 	}
 }
 
-// resetState clears all package-level hook state. Shared by every backend's
-// End() implementation (cgo and Wayland).
-func resetState() {
-	pressed = make(map[uint16]bool, 256)
-	uppressed = make(map[uint16]bool, 256)
-	used = []int{}
-
-	keys = map[int][]uint16{}
-	cbs = map[int]func(Event){}
-	events = map[uint8][]int{}
+// resetState clears the Hook's hotkey registry.
+func (h *Hook) resetState() {
+	h.regMu.Lock()
+	h.reg.Store(&registry{events: map[uint8][]*binding{}, root: &seqNode{}})
+	h.regMu.Unlock()
 }
@@ -127,12 +127,30 @@ static inline void post_mouse_button_event(iohook_event * const event) {
 	int win_y;
 	unsigned int mask;
 
+	// Wheel data lays out its position differently from button data.
+	int x = event->data.mouse.x, y = event->data.mouse.y;
+	if (event->type == EVENT_MOUSE_WHEEL) {
+		x = event->data.wheel.x;
+		y = event->data.wheel.y;
+	}
+
+	// MOUSE_BUTTON2 is the right button, X button 2 the middle one.
+	unsigned int button = event->data.mouse.button;
+	if (button == MOUSE_BUTTON2) {
+		button = Button3;
+	} else if (button == MOUSE_BUTTON3) {
+		button = Button2;
+	} else if (button > MOUSE_BUTTON3) {
+		// X buttons 4 to 7 are the wheel.
+		button += 4;
+	}
+
 	Window win_root = XDefaultRootWindow(properties_disp);
 	Bool query_status = XQueryPointer(properties_disp, win_root, &ret_root, &ret_child, &root_x, &root_y, &win_x, &win_y, &mask);
 	if (query_status) {
-		if (event->data.mouse.x != root_x || event->data.mouse.y != root_y) {
+		if (x != root_x || y != root_y) {
 			// Move the pointer to the specified position.
-			XTestFakeMotionEvent(properties_disp, -1, event->data.mouse.x, event->data.mouse.y, 0);
+			XTestFakeMotionEvent(properties_disp, -1, x, y, 0);
 		} else {
 			query_status = False;
 		}
@@ -141,20 +159,24 @@ static inline void post_mouse_button_event(iohook_event * const event) {
 	if (event->type == EVENT_MOUSE_WHEEL) {
 		// Wheel events should be the same as click events on X11.
 		// type, amount and rotation
-		if (event->data.wheel.rotation < 0) {
-			XTestFakeButtonEvent(properties_disp, WheelUp, True, 0);
-			XTestFakeButtonEvent(properties_disp, WheelUp, False, 0);
-		} else {
-			XTestFakeButtonEvent(properties_disp, WheelDown, True, 0);
-			XTestFakeButtonEvent(properties_disp, WheelDown, False, 0);
+		unsigned int wheel = event->data.wheel.rotation < 0 ? WheelUp : WheelDown;
+		if (event->data.wheel.direction == WHEEL_HORIZONTAL_DIRECTION) {
+			wheel = event->data.wheel.rotation < 0 ? WheelLeft : WheelRight;
 		}
+
+		// One button click per notch.
+		int32_t notches = abs(event->data.wheel.rotation);
+		do {
+			XTestFakeButtonEvent(properties_disp, wheel, True, 0);
+			XTestFakeButtonEvent(properties_disp, wheel, False, 0);
+		} while (--notches > 0);
 	} else if (event->type == EVENT_MOUSE_PRESSED) {
-		XTestFakeButtonEvent(properties_disp, event->data.mouse.button, True, 0);
+		XTestFakeButtonEvent(properties_disp, button, True, 0);
 	} else if (event->type == EVENT_MOUSE_RELEASED) {
-		XTestFakeButtonEvent(properties_disp, event->data.mouse.button, False, 0);
+		XTestFakeButtonEvent(properties_disp, button, False, 0);
 	} else if (event->type == EVENT_MOUSE_CLICKED) {
-		XTestFakeButtonEvent(properties_disp, event->data.mouse.button, True, 0);
-		XTestFakeButtonEvent(properties_disp, event->data.mouse.button, False, 0);
+		XTestFakeButtonEvent(properties_disp, button, True, 0);
+		XTestFakeButtonEvent(properties_disp, button, False, 0);
 	}
 
 	if (query_status) {
@@ -316,16 +338,16 @@ IOHOOK_API void hook_post_event(iohook_event * const event) {
 	XLockDisplay(properties_disp);
 
 	#ifdef USE_XTEST
+	unsigned int i;
+
 	// XTest does not have modifier support, so we fake it by depressing the
 	// appropriate modifier keys.
-	unsigned int i;
 	for (i = 0; i < sizeof(keymask_lookup) / sizeof(KeySym); i++) {
 		if (event->mask & 1 << i) {
 			XTestFakeKeyEvent(properties_disp, XKeysymToKeycode(properties_disp, keymask_lookup[i]), True, 0);
 		}
 	}
 
-	unsigned int i;
 	for (i = 0; i < sizeof(btnmask_lookup) / sizeof(unsigned int); i++) {
 		if (event->mask & btnmask_lookup[i]) {
 			XTestFakeButtonEvent(properties_disp, i + 1, True, 0);
@@ -365,13 +387,11 @@ IOHOOK_API void hook_post_event(iohook_event * const event) {
 
 	#ifdef USE_XTEST
 	// Release the previously held modifier keys used to fake the event mask.
-	unsigned int i ;
-	for (i= 0; i < sizeof(keymask_lookup) / sizeof(KeySym); i++) {
+	for (i = 0; i < sizeof(keymask_lookup) / sizeof(KeySym); i++) {
 		if (event->mask & 1 << i) {
 			XTestFakeKeyEvent(properties_disp, XKeysymToKeycode(properties_disp, keymask_lookup[i]), False, 0);
 		}
 	}
-	unsigned int i;
 	for (i = 0; i < sizeof(btnmask_lookup) / sizeof(unsigned int); i++) {
 		if (event->mask & btnmask_lookup[i]) {
 			XTestFakeButtonEvent(properties_disp, i + 1, False, 0);
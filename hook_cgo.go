@@ -24,7 +24,7 @@ package hook
 #cgo darwin CFLAGS: -x objective-c -Wno-deprecated-declarations
 #cgo darwin LDFLAGS: -framework Cocoa
 
-#cgo linux CFLAGS:-I/usr/src -std=gnu99
+#cgo linux CFLAGS:-I/usr/src -std=gnu99 -DUSE_XTEST
 #cgo linux LDFLAGS: -L/usr/src -lX11 -lXtst
 #cgo linux LDFLAGS: -lX11-xcb -lxcb -lxcb-xkb -lxkbcommon -lxkbcommon-x11
 //#cgo windows LDFLAGS: -lgdi32 -luser32
@@ -34,55 +34,128 @@ package hook
 import "C"
 
 import (
+	"fmt"
+	"runtime"
 	"time"
 	"unsafe"
 )
 
-// Start adds global event hook to OS
-// returns event channel
-func Start(tm ...int) chan Event {
-	ev = make(chan Event, 1024)
-	go C.start_ev()
+// backendName names this backend in Snapshot.
+const backendName = "libuiohook"
 
-	tm1 := 50
-	if len(tm) > 0 {
-		tm1 = tm[0]
-	}
+// osTime maps libuiohook's event times: X server or tick count
+// milliseconds, and mach_absolute_time ticks on macOS.
+var osTime = func() *osClock {
+	var numer, denom C.uint64_t
+	C.os_tick_ns(&numer, &denom)
+	return newOSClock(uint64(numer), uint64(denom), runtime.GOOS != "darwin")
+}()
+
+// pollBatch is how many events the poller takes from the C ring at once.
+const pollBatch = 64
+
+// runBackend adds global event hook to OS and delivers its events until
+// stopBackend is called. dispatch_proc wakes the poller as it queues each
+// event, so nothing waits on a timer.
+//
+// The optional tm argument, the former poll interval in milliseconds, is
+// accepted for compatibility but ignored.
+func runBackend(tm ...int) {
+	_ = tm
 
-	asyncon = true
+	C.start_poll()
+	polled := make(chan struct{})
 	go func() {
+		defer close(polled)
+		var buf [pollBatch]C.go_event
 		for {
-			if !asyncon {
+			n := int(C.wait_events(&buf[0], pollBatch))
+			if n < 0 {
 				return
 			}
-
-			C.pollEv()
-			time.Sleep(time.Millisecond * time.Duration(tm1))
-			//todo: find smallest time that does not destroy the cpu utilization
+			for i := range n {
+				r := rawOf(&buf[i])
+				sendRaw(&r)
+			}
+			if n := C.take_dropped(); n > 0 {
+				lose(uint64(n))
+			}
 		}
 	}()
 
-	return ev
+	// hook_run blocks until stopBackend stops the hook; only a failure
+	// returns early with a non-zero status.
+	if status := int(C.start_ev()); status != C.IOHOOK_SUCCESS {
+		fail(ioHookError(status))
+	}
+
+	// No event comes after hook_run returns: let the poller drain the ring
+	// and exit.
+	C.endPoll()
+	<-polled
 }
 
-// End removes global event hook
-func End(tm ...int) {
-	tm1 := 10
-	if len(tm) > 0 {
-		tm1 = tm[0]
+// rawOf copies a go_event out of the C ring.
+func rawOf(c *C.go_event) rawEvent {
+	return rawEvent{
+		time:      uint64(c.time),
+		rotation:  int32(c.rotation),
+		keychar:   uint32(c.keychar),
+		mask:      uint16(c.mask),
+		reserved:  uint16(c.reserved),
+		keycode:   uint16(c.keycode),
+		rawcode:   uint16(c.rawcode),
+		button:    uint16(c.button),
+		clicks:    uint16(c.clicks),
+		amount:    uint16(c.amount),
+		x:         int16(c.x),
+		y:         int16(c.y),
+		kind:      uint8(c._type),
+		direction: uint8(c.direction),
 	}
+}
 
-	asyncon = false
-	C.endPoll()
+// stopBackend removes global event hook
+func stopBackend() {
 	C.stop_event()
-	time.Sleep(time.Millisecond * time.Duration(tm1))
+}
 
-	for len(ev) != 0 {
-		<-ev
-	}
-	close(ev)
+// subscribe narrows dispatch_proc to the wanted kinds, so libuiohook
+// events nobody wants are not queued. The libuiohook event types are
+// the Event kinds.
+func subscribe(kinds kindSet) error {
+	C.set_want_kinds(C.uint32_t(kinds))
+	return nil
+}
 
-	resetState()
+// ioHookError maps a libuiohook hook_run() status to its Err* error.
+func ioHookError(status int) error {
+	cause := fmt.Errorf("libuiohook status %#x", status)
+
+	switch status {
+	case C.IOHOOK_ERROR_OUT_OF_MEMORY:
+		return wrapErr(ErrOutOfMemory, cause)
+	case C.IOHOOK_ERROR_X_OPEN_DISPLAY:
+		return wrapErr(ErrNoDisplay, cause)
+	case C.IOHOOK_ERROR_X_RECORD_NOT_FOUND:
+		return wrapErr(ErrRecordUnavailable, cause)
+	case C.IOHOOK_ERROR_X_RECORD_ALLOC_RANGE,
+		C.IOHOOK_ERROR_X_RECORD_CREATE_CONTEXT,
+		C.IOHOOK_ERROR_X_RECORD_ENABLE_CONTEXT,
+		C.IOHOOK_ERROR_X_RECORD_GET_CONTEXT:
+		return wrapErr(ErrRecordContext, cause)
+	case C.IOHOOK_ERROR_AXAPI_DISABLED:
+		return wrapErr(ErrAccessDenied, cause)
+	case C.IOHOOK_ERROR_SET_WINDOWS_HOOK_EX,
+		C.IOHOOK_ERROR_GET_MODULE_HANDLE,
+		C.IOHOOK_ERROR_CREATE_EVENT_PORT,
+		C.IOHOOK_ERROR_CREATE_RUN_LOOP_SOURCE,
+		C.IOHOOK_ERROR_GET_RUNLOOP,
+		C.IOHOOK_ERROR_CREATE_OBSERVER:
+		return wrapErr(ErrHookInstall, cause)
+	default:
+		return wrapErr(ErrBackend, cause)
+	}
 }
 
 // addEvent add the block event listener
@@ -100,3 +173,44 @@ func addEvent(key string) int {
 func StopEvent() {
 	C.stop_event()
 }
+
+// postEvent posts ev through libuiohook's hook_post_event.
+func postEvent(ev Event) error {
+	typ := C.int(ev.Kind)
+	if ev.Kind == MouseUp {
+		// MouseUp is libuiohook's click; post the release.
+		typ = C.EVENT_MOUSE_RELEASED
+	}
+
+	// libuiohook cannot tell injected input apart: expect the events to
+	// come back, so sendRaw can tag them.
+	now := time.Now()
+	switch ev.Kind {
+	case MouseUp:
+		// The release, then a click if the pointer stayed.
+		posted.add(Event{Kind: MouseHold, Button: ev.Button}, now)
+		posted.add(Event{Kind: MouseUp, Button: ev.Button}, now)
+	case MouseWheel:
+		n := int32(1)
+		if runtime.GOOS == "linux" {
+			// X11 reports one event per notch.
+			n = max(ev.Rotation, -ev.Rotation, 1)
+		}
+		for range n {
+			posted.add(ev, now)
+		}
+	default:
+		posted.add(ev, now)
+	}
+
+	C.post_ev(typ, C.uint16_t(ev.Mask), C.uint16_t(ev.Keycode),
+		C.uint16_t(ev.Button), C.int16_t(ev.X), C.int16_t(ev.Y),
+		C.int32_t(ev.Rotation), C.uint8_t(ev.Direction))
+	return nil
+}
+
+// grabHotkey: grabs are implemented on the pure-Go X11 backend only.
+func grabHotkey(hk Hotkey) (release func(), err error) {
+	_ = hk
+	return nil, ErrNotSupported
+}
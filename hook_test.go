@@ -1,9 +1,14 @@
 package hook
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"runtime"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/vcaesar/tt"
 )
@@ -29,3 +34,271 @@ func TestKey(t *testing.T) {
 	r := KeycharToRawcode("error")
 	tt.Equal(t, 0, r)
 }
+
+func TestHooks(t *testing.T) {
+	h1, h2 := New(Options{}), New(Options{Buffer: 8})
+	e1, e2 := h1.Start(), h2.Start()
+	tt.Equal(t, 8, cap(e2))
+
+	_, err := h1.Register(KeyDown, []string{"a"}, func(e Event) {})
+	tt.Nil(t, err)
+	tt.Equal(t, 1, count(h1))
+	tt.Equal(t, 0, count(h2))
+
+	send(Event{Kind: KeyDown, Keycode: Keycode["a"]})
+	for _, s := range []chan Event{e1, e2} {
+		for e := range s {
+			if e.Kind == KeyDown {
+				tt.Equal(t, Keycode["a"], e.Keycode)
+				break
+			}
+		}
+	}
+
+	h2.End()
+	tt.Equal(t, 1, count(h1))
+	h1.End()
+	tt.Equal(t, 0, count(h1))
+}
+
+func TestKinds(t *testing.T) {
+	keys := kindsOf([]uint8{KeyDown, KeyUp})
+	tt.True(t, keys.has(KeyDown))
+	tt.True(t, keys.has(HookDisabled))
+	tt.False(t, keys.has(KeyHold))
+	tt.False(t, keys.has(MouseMove))
+	tt.True(t, kindsOf(nil).has(MouseMove))
+
+	// Other Hooks may be running: wanted is at least what h1 needs.
+	hookMu.Lock()
+	var others kindSet
+	for _, o := range hooks {
+		others |= o.kinds
+	}
+	hookMu.Unlock()
+	h1, h2 := New(Options{Kinds: []uint8{KeyDown, KeyUp}}), New(Options{})
+	e1 := h1.Start()
+	tt.Equal(t, keys, kindSet(wanted.Load())&keys)
+	e2 := h2.Start()
+	tt.Equal(t, allKinds, kindSet(wanted.Load()))
+
+	send(Event{Kind: MouseMove, X: 1})
+	send(Event{Kind: KeyDown, Keycode: Keycode["a"]})
+	for e := range e1 {
+		if e.Kind != HookEnabled && e.Kind != HookDisabled {
+			tt.Equal(t, KeyDown, int(e.Kind))
+			break
+		}
+	}
+	for e := range e2 {
+		if e.Kind == MouseMove {
+			break
+		}
+	}
+
+	// wanted narrows back once h2 leaves.
+	h2.End()
+	tt.Equal(t, others|keys, kindSet(wanted.Load()))
+	h1.End()
+}
+
+func TestPolicy(t *testing.T) {
+	key := func(name string) Event {
+		return Event{Kind: KeyDown, Keycode: Keycode[name]}
+	}
+
+	h, _ := runningHook(Options{Buffer: 2})
+	for _, k := range []string{"a", "b", "c", "d"} {
+		h.push(key(k))
+	}
+	tt.Equal(t, uint64(2), h.Dropped())
+	tt.Equal(t, Keycode["a"], (<-h.ev).Keycode)
+	tt.False(t, (<-h.ev).Gap)
+	h.push(key("e"))
+	e := <-h.ev
+	tt.Equal(t, Keycode["e"], e.Keycode)
+	tt.True(t, e.Gap)
+	h.push(key("f"))
+	tt.False(t, (<-h.ev).Gap)
+
+	h, _ = runningHook(Options{Buffer: 2, Policy: DropOldest})
+	for _, k := range []string{"a", "b", "c", "d"} {
+		h.push(key(k))
+	}
+	tt.Equal(t, uint64(2), h.Dropped())
+	tt.Equal(t, Keycode["c"], (<-h.ev).Keycode)
+	e = <-h.ev
+	tt.Equal(t, Keycode["d"], e.Keycode)
+	tt.True(t, e.Gap)
+
+	// Block never waits in push: one channel's worth of events queues.
+	h, _ = runningHook(Options{Buffer: 1, Policy: Block,
+		BlockTimeout: 200 * time.Millisecond})
+	h.push(key("a"))
+	h.push(key("b"))
+	h.push(key("c"))
+	tt.Equal(t, uint64(1), h.Dropped())
+	tt.Equal(t, Keycode["a"], (<-h.ev).Keycode)
+	tt.Equal(t, Keycode["b"], (<-h.ev).Keycode)
+	// A queued event that finds no room in time is dropped.
+	h.push(key("d"))
+	h.push(key("e"))
+	time.Sleep(400 * time.Millisecond)
+	tt.Equal(t, uint64(2), h.Dropped())
+	tt.Equal(t, Keycode["d"], (<-h.ev).Keycode)
+	h.push(key("f"))
+	e = <-h.ev
+	tt.Equal(t, Keycode["f"], e.Keycode)
+	tt.True(t, e.Gap)
+	h.blocked.stop()
+
+	lose(3) // no running Hooks
+	tt.Equal(t, uint64(2), h.Dropped())
+}
+
+func TestLifecycle(t *testing.T) {
+	h := New(Options{})
+	tt.Equal(t, Idle, h.State())
+	<-h.Done() // never started: already done
+
+	for i := 0; i < 20; i++ {
+		s := h.Start()
+		tt.NotEqual(t, Idle, h.State())
+
+		var wg sync.WaitGroup
+		for j := 0; j < 4; j++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				h.End()
+			}()
+		}
+		wg.Wait()
+
+		<-h.Done()
+		tt.Equal(t, Stopped, h.State())
+		for range s {
+			// drain until End's close
+		}
+	}
+
+	h.End()
+	tt.Equal(t, "Stopping", Stopping.String())
+}
+
+func TestStartRunning(t *testing.T) {
+	h, _ := runningHook(Options{})
+	s, err := h.StartContext(context.Background())
+	tt.Nil(t, s)
+	tt.True(t, errors.Is(err, ErrAlreadyRunning))
+	tt.Equal(t, Running, h.State())
+}
+
+func TestRegister(t *testing.T) {
+	h := New(Options{})
+
+	_, err := h.Register(KeyDown, []string{"ctrl", "nosuchkey"}, func(e Event) {})
+	tt.Equal(t, true, errors.Is(err, ErrUnknownKey))
+	tt.Equal(t, 0, count(h))
+
+	b, err := h.Register(KeyDown, []string{"ctrl", "q"}, func(e Event) {})
+	tt.Nil(t, err)
+	tt.Equal(t, 1, len(h.reg.Load().events[KeyDown]))
+
+	b.Disable()
+	tt.Equal(t, true, b.b.off.Load())
+	b.Enable()
+	tt.Equal(t, false, b.b.off.Load())
+
+	b.Unregister()
+	tt.Equal(t, 0, count(h))
+	tt.Equal(t, 0, len(h.reg.Load().events[KeyDown]))
+
+	// The zero Binding is inert.
+	Binding{}.Unregister()
+}
+
+// count returns the number of callbacks registered on h.
+func count(h *Hook) int {
+	n := 0
+	for _, bs := range h.reg.Load().events {
+		n += len(bs)
+	}
+	return n
+}
+
+func TestProcess(t *testing.T) {
+	h := New(Options{})
+	ctrl, q := Keycode["ctrl"], Keycode["q"]
+
+	var hits atomic.Int32
+	b, err := h.Register(KeyDown, []string{"ctrl", "q"}, func(e Event) {
+		hits.Add(1)
+	})
+	tt.Nil(t, err)
+
+	evs := make(chan Event)
+	out := h.Process(evs)
+	// The second send only completes once the first event is dispatched.
+	feed := func(e Event) {
+		evs <- e
+		evs <- Event{Kind: MouseMove}
+	}
+
+	feed(Event{Kind: KeyDown, Keycode: ctrl})
+	feed(Event{Kind: KeyDown, Keycode: Keycode["a"]})
+	tt.Equal(t, int32(0), hits.Load())
+	feed(Event{Kind: KeyDown, Keycode: q})
+	tt.Equal(t, int32(1), hits.Load())
+
+	b.Disable()
+	feed(Event{Kind: KeyDown, Keycode: q})
+	tt.Equal(t, int32(1), hits.Load())
+	b.Enable()
+	feed(Event{Kind: KeyDown, Keycode: q})
+	tt.Equal(t, int32(2), hits.Load())
+
+	close(evs)
+	<-out
+}
+
+// TestRegistryRace is meant for go test -race: it registers, toggles and
+// removes bindings while Process dispatches on another goroutine.
+func TestRegistryRace(t *testing.T) {
+	h := New(Options{})
+	evs := make(chan Event)
+	out := h.Process(evs)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 200; j++ {
+				b, err := h.Register(KeyDown, []string{"ctrl", "q"}, func(e Event) {})
+				tt.Nil(t, err)
+				b.Disable()
+				b.Enable()
+				b.Unregister()
+			}
+		}()
+	}
+
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	kinds := []uint8{KeyDown, KeyUp}
+	for i := 0; ; i++ {
+		select {
+		case <-done:
+			close(evs)
+			<-out
+			tt.Equal(t, 0, count(h))
+			return
+		case evs <- Event{Kind: kinds[i%2], Keycode: Keycode["q"]}:
+		}
+	}
+}
@@ -0,0 +1,465 @@
+// Copyright 2016 The go-vgo Project Developers. See the COPYRIGHT
+// file at the top-level directory of this distribution and at
+// https://github.com/go-vgo/robotgo/blob/master/LICENSE
+//
+// Licensed under the Apache License, Version 2.0 <LICENSE-APACHE or
+// http://www.apache.org/licenses/LICENSE-2.0> or the MIT license
+// <LICENSE-MIT or http://opensource.org/licenses/MIT>, at your
+// option. This file may not be copied, modified, or distributed
+// except according to those terms.
+
+package hook
+
+import (
+	"fmt"
+	"maps"
+	"runtime"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Modifier is a set of modifier keys held for a Hotkey. Each modifier has a
+// left and a right bit; a Hotkey with both bits set accepts either side.
+type Modifier uint8
+
+// Sided modifier keys.
+const (
+	ModLCtrl Modifier = 1 << iota
+	ModRCtrl
+	ModLAlt
+	ModRAlt
+	ModLShift
+	ModRShift
+	ModLCmd
+	ModRCmd
+)
+
+// Modifier keys on either side, in the order Hotkey.String writes them.
+const (
+	ModCtrl  = ModLCtrl | ModRCtrl
+	ModAlt   = ModLAlt | ModRAlt
+	ModShift = ModLShift | ModRShift
+	ModCmd   = ModLCmd | ModRCmd
+)
+
+// Match selects how a binding compares the held modifiers with its own.
+type Match uint8
+
+const (
+	// Subset fires while at least the binding's keys are held, whatever
+	// other modifiers are down. It is the default for Register.
+	Subset Match = iota
+	// Exact fires only when the held modifiers are exactly the binding's,
+	// so "Ctrl+Q" does not fire on Ctrl+Shift+Q. It is the default for
+	// RegisterHotkey.
+	Exact
+)
+
+// vcCtrlR is libuiohook's VC_CONTROL_R, which Keycode lacks.
+const vcCtrlR = 0x0E1D
+
+// modCodes maps modifier keycodes to their Modifier.
+var modCodes = map[uint16]Modifier{
+	Keycode["ctrl"]:   ModLCtrl,
+	vcCtrlR:           ModRCtrl,
+	Keycode["alt"]:    ModLAlt,
+	Keycode["altr"]:   ModRAlt,
+	Keycode["shift"]:  ModLShift,
+	Keycode["shiftr"]: ModRShift,
+	Keycode["cmd"]:    ModLCmd,
+	Keycode["cmdr"]:   ModRCmd,
+}
+
+// maskMods maps Event.Mask modifier bits to their Modifier.
+var maskMods = []struct {
+	mask uint16
+	mod  Modifier
+}{
+	{maskCtrlL, ModLCtrl}, {maskCtrlR, ModRCtrl},
+	{maskAltL, ModLAlt}, {maskAltR, ModRAlt},
+	{maskShiftL, ModLShift}, {maskShiftR, ModRShift},
+	{maskMetaL, ModLCmd}, {maskMetaR, ModRCmd},
+}
+
+// heldMods returns the modifiers held according to the pressed keys and
+// the event's modifier mask. The mask also covers keys pressed before the
+// hook started.
+func heldMods(pressed map[uint16]bool, mask uint16) Modifier {
+	var m Modifier
+	for code, mod := range modCodes {
+		if pressed[code] {
+			m |= mod
+		}
+	}
+
+	for _, v := range maskMods {
+		if mask&v.mask != 0 {
+			m |= v.mod
+		}
+	}
+	return m
+}
+
+// modsMatch reports whether the held modifiers satisfy want. For each
+// modifier want names either side, one side or none; Exact also rejects
+// modifiers (or sides) that want does not name.
+func modsMatch(held, want Modifier, m Match) bool {
+	for _, n := range modNames {
+		w, h := want&n.mod, held&n.mod
+		switch {
+		case w == 0:
+			if m == Exact && h != 0 {
+				return false
+			}
+		case w == n.mod:
+			if h == 0 {
+				return false
+			}
+		default:
+			if h&w == 0 || m == Exact && h != w {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// modNames holds the canonical name and token of each modifier. The sided
+// forms are prefixed with L/R: "RCtrl", "lshift".
+var modNames = []struct {
+	mod  Modifier
+	name string
+	key  string
+}{
+	{ModCtrl, "Ctrl", "ctrl"},
+	{ModAlt, "Alt", "alt"},
+	{ModShift, "Shift", "shift"},
+	{ModCmd, "Cmd", "cmd"},
+}
+
+// modAlias maps the lower-case modifier tokens accepted by ParseHotkey and
+// Register, including the l/r-prefixed sided forms added by init.
+// "cmdorctrl" is resolved by cmdOrCtrl.
+var modAlias = map[string]Modifier{
+	"ctrl":    ModCtrl,
+	"control": ModCtrl,
+	"alt":     ModAlt,
+	"option":  ModAlt,
+	"opt":     ModAlt,
+	"shift":   ModShift,
+	"cmd":     ModCmd,
+	"command": ModCmd,
+	"super":   ModCmd,
+	"win":     ModCmd,
+	"windows": ModCmd,
+	"meta":    ModCmd,
+
+	// Keycode's names for the right-hand keys.
+	"ctrlr":  ModRCtrl,
+	"altr":   ModRAlt,
+	"shiftr": ModRShift,
+	"cmdr":   ModRCmd,
+}
+
+// leftMods are the left-hand bits of every modifier.
+const leftMods = ModLCtrl | ModLAlt | ModLShift | ModLCmd
+
+func init() {
+	for name, mod := range maps.Clone(modAlias) {
+		if left := mod & leftMods; left != 0 && left != mod {
+			modAlias["l"+name] = left
+			modAlias["r"+name] = mod &^ leftMods
+		}
+	}
+}
+
+// Wheel directions of a binding.
+const (
+	wheelUp = 1 + iota
+	wheelDown
+	wheelLeft
+	wheelRight
+)
+
+// mouseTokens are the mouse button and wheel tokens usable in bindings,
+// named as in AddEvent, with their Hotkey.String name.
+var mouseTokens = map[string]struct {
+	name   string
+	button uint16 // Event.Button, or 0 for a wheel direction
+	wheel  uint8
+}{
+	"mleft":      {"MouseLeft", 1, 0},
+	"mright":     {"MouseRight", 2, 0},
+	"center":     {"MouseMiddle", 3, 0},
+	"mback":      {"MouseBack", 4, 0},
+	"mforward":   {"MouseForward", 5, 0},
+	"wheelUp":    {"WheelUp", 0, wheelUp},
+	"wheelDown":  {"WheelDown", 0, wheelDown},
+	"wheelLeft":  {"WheelLeft", 0, wheelLeft},
+	"wheelRight": {"WheelRight", 0, wheelRight},
+}
+
+// buttonMask returns the Event.Mask bit of a mouse button.
+func buttonMask(button uint16) uint16 {
+	if button < 1 || button > 5 {
+		return 0
+	}
+	return maskButton1 << (button - 1)
+}
+
+// wheelOf returns the wheel direction of a MouseWheel event.
+func wheelOf(ev Event) uint8 {
+	switch {
+	case ev.Direction == wheelVertical && ev.Rotation < 0:
+		return wheelUp
+	case ev.Direction == wheelVertical && ev.Rotation > 0:
+		return wheelDown
+	case ev.Direction == wheelHorizontal && ev.Rotation < 0:
+		return wheelLeft
+	case ev.Direction == wheelHorizontal && ev.Rotation > 0:
+		return wheelRight
+	}
+	return 0
+}
+
+// keyAlias maps lower-case key tokens to their Keycode name.
+var keyAlias = map[string]string{
+	"escape":     "esc",
+	"return":     "enter",
+	"backspace":  "delete",
+	"spacebar":   "space",
+	"plus":       "+",
+	"minus":      "-",
+	"arrowup":    "up",
+	"arrowdown":  "down",
+	"arrowleft":  "left",
+	"arrowright": "right",
+}
+
+func init() {
+	for token, m := range mouseTokens {
+		keyAlias[strings.ToLower(token)] = token
+		keyAlias[strings.ToLower(m.name)] = token
+	}
+	keyAlias["mousecenter"] = "center"
+	keyAlias["mmiddle"] = "center"
+}
+
+// Hotkey is a key pressed together with a set of modifiers, as in the
+// accelerator "Ctrl+Shift+Q".
+type Hotkey struct {
+	Mods Modifier
+	// Key is the Keycode name of the key, e.g. "q" or "f4", a modifier
+	// token such as "shift" or "rctrl" for a modifier-only hotkey, or a
+	// mouse token such as "mleft" or "wheelUp".
+	Key string
+}
+
+// ParseHotkey parses an accelerator such as "Ctrl+Shift+Q", "Super+Enter",
+// "CmdOrCtrl+S" or "Alt+WheelUp". Names are case-insensitive; the last token
+// is the key or mouse button and the others must be modifiers. A modifier
+// matches either side unless prefixed with L or R ("RAlt+K"). CmdOrCtrl is
+// Cmd on macOS and Ctrl elsewhere. Unknown names are reported with
+// ErrUnknownKey, malformed strings with ErrInvalidHotkey.
+func ParseHotkey(s string) (Hotkey, error) {
+	var hk Hotkey
+
+	toks := strings.Split(s, "+")
+	if strings.HasSuffix(s, "++") || s == "+" {
+		// The key itself is "+": "Ctrl++".
+		toks = append(toks[:len(toks)-2], "plus")
+	}
+
+	for i, tok := range toks {
+		t := strings.ToLower(strings.TrimSpace(tok))
+		if t == "" {
+			return Hotkey{}, fmt.Errorf("%w %q", ErrInvalidHotkey, s)
+		}
+
+		mod, isMod := modAlias[t]
+		if t == "cmdorctrl" || t == "commandorcontrol" {
+			mod, isMod = cmdOrCtrl(), true
+		}
+
+		if i < len(toks)-1 {
+			if !isMod {
+				return Hotkey{}, fmt.Errorf("%w %q: %q is not a modifier",
+					ErrInvalidHotkey, s, tok)
+			}
+			hk.Mods |= mod
+			continue
+		}
+
+		// A lone modifier is a key of its own: "Ctrl+Shift".
+		if isMod {
+			hk.Key, _ = modToken(mod)
+			continue
+		}
+		if a, ok := keyAlias[t]; ok {
+			t = a
+		}
+		if _, ok := mouseTokens[t]; ok {
+			hk.Key = t
+			continue
+		}
+		if _, ok := Keycode[t]; !ok {
+			return Hotkey{}, fmt.Errorf("%w %q", ErrUnknownKey, tok)
+		}
+		hk.Key = t
+	}
+
+	return hk, nil
+}
+
+// cmdOrCtrl is the platform's primary shortcut modifier.
+func cmdOrCtrl() Modifier {
+	if runtime.GOOS == "darwin" {
+		return ModCmd
+	}
+	return ModCtrl
+}
+
+// modToken returns the canonical token and display name of a single
+// modifier, e.g. "ctrl" and "Ctrl", or "rctrl" and "RCtrl".
+func modToken(m Modifier) (key, name string) {
+	for _, n := range modNames {
+		switch m {
+		case n.mod:
+			return n.key, n.name
+		case n.mod & leftMods:
+			return "l" + n.key, "L" + n.name
+		case n.mod &^ leftMods:
+			return "r" + n.key, "R" + n.name
+		}
+	}
+	return "", ""
+}
+
+// String returns the canonical accelerator, e.g. "Ctrl+Shift+Q", which
+// ParseHotkey parses back to the same Hotkey.
+func (hk Hotkey) String() string {
+	var b strings.Builder
+	for _, n := range modNames {
+		if m := hk.Mods & n.mod; m != 0 {
+			_, name := modToken(m)
+			b.WriteString(name)
+			b.WriteByte('+')
+		}
+	}
+
+	if m, ok := modAlias[hk.Key]; ok {
+		_, name := modToken(m)
+		b.WriteString(name)
+		return b.String()
+	}
+	if m, ok := mouseTokens[hk.Key]; ok {
+		b.WriteString(m.name)
+		return b.String()
+	}
+
+	switch hk.Key {
+	case "+":
+		b.WriteString("Plus")
+	default:
+		r, size := utf8.DecodeRuneInString(hk.Key)
+		b.WriteRune(unicode.ToUpper(r))
+		b.WriteString(hk.Key[size:])
+	}
+
+	return b.String()
+}
+
+// matches reports whether a key event for code, with the held modifiers
+// down, presses hk.
+func (hk Hotkey) matches(code uint16, held Modifier) bool {
+	if m, ok := modAlias[hk.Key]; ok {
+		return modCodes[code]&m != 0 && modsMatch(held, hk.Mods|m, Exact)
+	}
+	return Keycode[hk.Key] == code && modsMatch(held, hk.Mods, Exact)
+}
+
+// keys returns the Keycode names making up the hotkey, for Register.
+func (hk Hotkey) keys() []string {
+	names := []string{}
+	for _, n := range modNames {
+		if m := hk.Mods & n.mod; m != 0 {
+			key, _ := modToken(m)
+			names = append(names, key)
+		}
+	}
+	return append(names, hk.Key)
+}
+
+// RegisterHotkey registers cb on the default Hook, see Hook.RegisterHotkey.
+func RegisterHotkey(s string, cb func(Event)) (Binding, error) {
+	return std.RegisterHotkey(s, cb)
+}
+
+// RegisterHotkey parses the accelerator s with ParseHotkey and registers cb
+// to run when it is pressed with exactly its modifiers held: on KeyDown, or
+// on MouseDown or MouseWheel for a mouse hotkey.
+func (h *Hook) RegisterHotkey(s string, cb func(Event)) (Binding, error) {
+	hk, err := ParseHotkey(s)
+	if err != nil {
+		return Binding{}, err
+	}
+	return h.registerHotkey(hk, cb)
+}
+
+// RegisterGrab registers cb on the default Hook, see Hook.RegisterGrab.
+func RegisterGrab(s string, cb func(Event)) (Binding, error) {
+	return std.RegisterGrab(s, cb)
+}
+
+// RegisterGrab is RegisterHotkey for a hotkey the hook takes for itself:
+// its presses run cb but no longer reach the focused window. The backend
+// must be running, and the grab ends with it or with Unregister.
+//
+// Only the pure-Go X11 backend can grab, with passive grabs on the root
+// window that ignore NumLock and CapsLock; the others return
+// ErrNotSupported. X grabs do not tell left from right modifiers, so
+// "RCtrl+K" takes either Ctrl+K but runs cb for the right one only. A
+// hotkey another client already grabs returns ErrGrabConflict, and a
+// modifier-only hotkey ErrInvalidHotkey.
+func (h *Hook) RegisterGrab(s string, cb func(Event)) (Binding, error) {
+	hk, err := ParseHotkey(s)
+	if err != nil {
+		return Binding{}, err
+	}
+	if _, ok := modAlias[hk.Key]; ok {
+		return Binding{}, fmt.Errorf("%w %q: cannot grab a modifier alone",
+			ErrInvalidHotkey, s)
+	}
+
+	b, err := hotkeyBinding(hk, cb)
+	if err != nil {
+		return Binding{}, err
+	}
+	// Set release before publishing: Process and Unregister may read the
+	// binding from then on.
+	if b.release, err = grabHotkey(hk); err != nil {
+		return Binding{}, err
+	}
+	return h.publish(b), nil
+}
+
+func (h *Hook) registerHotkey(hk Hotkey, cb func(Event)) (Binding, error) {
+	b, err := hotkeyBinding(hk, cb)
+	if err != nil {
+		return Binding{}, err
+	}
+	return h.publish(b), nil
+}
+
+// hotkeyBinding returns the unpublished binding of hk.
+func hotkeyBinding(hk Hotkey, cb func(Event)) (*binding, error) {
+	when := uint8(KeyDown)
+	if m, ok := mouseTokens[hk.Key]; ok {
+		when = MouseDown
+		if m.wheel != 0 {
+			when = MouseWheel
+		}
+	}
+	return newBinding(when, hk.String(), hk.keys(), Exact, cb)
+}
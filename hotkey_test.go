@@ -0,0 +1,226 @@
+package hook
+
+import (
+	"errors"
+	"runtime"
+	"testing"
+
+	"github.com/vcaesar/tt"
+)
+
+func TestParseHotkey(t *testing.T) {
+	primary := ModCtrl
+	if runtime.GOOS == "darwin" {
+		primary = ModCmd
+	}
+
+	cases := []struct {
+		in  string
+		out Hotkey
+	}{
+		{"Ctrl+Shift+Q", Hotkey{ModCtrl | ModShift, "q"}},
+		{"shift+CONTROL+q", Hotkey{ModCtrl | ModShift, "q"}},
+		{"Super+Enter", Hotkey{ModCmd, "enter"}},
+		{"Win+Return", Hotkey{ModCmd, "enter"}},
+		{"Alt+F4", Hotkey{ModAlt, "f4"}},
+		{"CmdOrCtrl+S", Hotkey{primary, "s"}},
+		{"Escape", Hotkey{0, "esc"}},
+		{"Ctrl+Shift", Hotkey{ModCtrl, "shift"}},
+		{"Meta+Alt+Up", Hotkey{ModAlt | ModCmd, "up"}},
+		{"Ctrl++", Hotkey{ModCtrl, "+"}},
+		{"RAlt+K", Hotkey{ModRAlt, "k"}},
+		{"lctrl+rshift+LWin+X", Hotkey{ModLCtrl | ModRShift | ModLCmd, "x"}},
+		{"Ctrl+RShift", Hotkey{ModCtrl, "rshift"}},
+		{"Ctrl+MouseLeft", Hotkey{ModCtrl, "mleft"}},
+		{"alt+wheelup", Hotkey{ModAlt, "wheelUp"}},
+		{"Shift+MBack", Hotkey{ModShift, "mback"}},
+	}
+
+	for _, c := range cases {
+		hk, err := ParseHotkey(c.in)
+		tt.Nil(t, err)
+		tt.Equal(t, c.out, hk)
+
+		rt, err := ParseHotkey(hk.String())
+		tt.Nil(t, err)
+		tt.Equal(t, hk, rt)
+	}
+
+	hk, _ := ParseHotkey("shift+alt+ctrl+super+x")
+	tt.Equal(t, "Ctrl+Alt+Shift+Cmd+X", hk.String())
+	hk, _ = ParseHotkey("ralt+lshift+shiftr+ctrlr")
+	tt.Equal(t, "RAlt+Shift+RCtrl", hk.String())
+
+	for _, s := range []string{"", "Ctrl+", "Ctrl++Q", "Q+Ctrl"} {
+		_, err := ParseHotkey(s)
+		tt.Equal(t, true, errors.Is(err, ErrInvalidHotkey), s)
+	}
+	_, err := ParseHotkey("Ctrl+Nope")
+	tt.Equal(t, true, errors.Is(err, ErrUnknownKey))
+}
+
+func TestRegisterHotkey(t *testing.T) {
+	h := New(Options{})
+	_, err := h.RegisterHotkey("Hyper+Q", func(e Event) {})
+	tt.Equal(t, true, errors.Is(err, ErrInvalidHotkey))
+
+	b, err := h.RegisterHotkey("Ctrl+Q", func(e Event) {})
+	tt.Nil(t, err)
+	tt.Equal(t, []uint16{Keycode["q"]}, b.b.keys)
+	tt.Equal(t, ModCtrl, b.b.mods)
+}
+
+func TestRegisterGrab(t *testing.T) {
+	h := New(Options{})
+	_, err := h.RegisterGrab("Ctrl+Shift", func(e Event) {})
+	tt.Equal(t, true, errors.Is(err, ErrInvalidHotkey))
+
+	// No backend is running: the grab fails and nothing is registered.
+	_, err = h.RegisterGrab("Ctrl+Alt+T", func(e Event) {})
+	tt.NotNil(t, err)
+	tt.Equal(t, 0, len(h.reg.Load().events[KeyDown]))
+}
+
+func TestExactMatch(t *testing.T) {
+	h := New(Options{})
+	var got []string
+	hit := func(name string) func(Event) {
+		return func(Event) { got = append(got, name) }
+	}
+
+	_, err := h.RegisterHotkey("Ctrl+Q", hit("ctrl+q"))
+	tt.Nil(t, err)
+	_, err = h.RegisterHotkey("Ctrl+Shift+Q", hit("ctrl+shift+q"))
+	tt.Nil(t, err)
+	sub, err := h.Register(KeyDown, []string{"ctrl", "q"}, hit("subset"))
+	tt.Nil(t, err)
+
+	evs := make(chan Event)
+	out := h.Process(evs)
+	press := func(es ...Event) []string {
+		got = nil
+		for _, e := range es {
+			evs <- e
+		}
+		evs <- Event{Kind: MouseMove} // wait for the last dispatch
+		return got
+	}
+	down := func(k string) Event { return Event{Kind: KeyDown, Keycode: Keycode[k]} }
+	up := func(k string) Event { return Event{Kind: KeyUp, Keycode: Keycode[k]} }
+
+	tt.Equal(t, []string{"ctrl+q", "subset"},
+		press(down("ctrl"), down("q"), up("q")))
+	tt.Equal(t, []string{"ctrl+shift+q", "subset"},
+		press(down("shift"), down("q"), up("q"), up("shift")))
+
+	// A modifier known only from the event mask, e.g. held before the hook
+	// started, counts as held too.
+	shifted := Event{Kind: KeyDown, Keycode: Keycode["q"], Mask: maskShiftR}
+	tt.Equal(t, []string{"ctrl+shift+q", "subset"}, press(shifted))
+	sub.SetMatch(Exact)
+	tt.Equal(t, []string{"ctrl+shift+q"}, press(shifted))
+	tt.Equal(t, []string{"ctrl+q", "subset"}, press(down("q")))
+
+	close(evs)
+	<-out
+}
+
+func TestSidedModifiers(t *testing.T) {
+	h := New(Options{})
+	var got []string
+	hit := func(name string) func(Event) {
+		return func(Event) { got = append(got, name) }
+	}
+
+	_, err := h.RegisterHotkey("RAlt+K", hit("ralt+k"))
+	tt.Nil(t, err)
+	_, err = h.RegisterHotkey("LAlt+K", hit("lalt+k"))
+	tt.Nil(t, err)
+	_, err = h.Register(KeyDown, []string{"ctrl", "j"}, hit("ctrl+j"))
+	tt.Nil(t, err)
+	_, err = h.Register(KeyDown, []string{"rctrl", "j"}, hit("rctrl+j"))
+	tt.Nil(t, err)
+
+	evs := make(chan Event)
+	out := h.Process(evs)
+	press := func(es ...Event) []string {
+		got = nil
+		for _, e := range es {
+			evs <- e
+		}
+		evs <- Event{Kind: MouseMove}
+		return got
+	}
+	down := func(c uint16) Event { return Event{Kind: KeyDown, Keycode: c} }
+	up := func(c uint16) Event { return Event{Kind: KeyUp, Keycode: c} }
+	k, j := Keycode["k"], Keycode["j"]
+
+	tt.Equal(t, []string{"ralt+k"},
+		press(down(Keycode["altr"]), down(k), up(k), up(Keycode["altr"])))
+	tt.Equal(t, []string{"lalt+k"},
+		press(down(Keycode["alt"]), down(k), up(k), up(Keycode["alt"])))
+	tt.Equal(t, []string{"ctrl+j"},
+		press(down(Keycode["ctrl"]), down(j), up(j), up(Keycode["ctrl"])))
+	tt.Equal(t, []string{"ctrl+j", "rctrl+j"},
+		press(down(vcCtrlR), down(j), up(j), up(vcCtrlR)))
+	tt.Equal(t, []string{"ralt+k"},
+		press(Event{Kind: KeyDown, Keycode: k, Mask: maskAltR}))
+
+	close(evs)
+	<-out
+}
+
+func TestMouseBindings(t *testing.T) {
+	h := New(Options{})
+	var got []string
+	hit := func(name string) func(Event) {
+		return func(Event) { got = append(got, name) }
+	}
+
+	_, err := h.RegisterHotkey("Ctrl+MouseLeft", hit("ctrl+click"))
+	tt.Nil(t, err)
+	_, err = h.RegisterHotkey("Alt+WheelUp", hit("alt+wheelup"))
+	tt.Nil(t, err)
+	_, err = h.Register(MouseDown, []string{"mleft", "mright"}, hit("chord"))
+	tt.Nil(t, err)
+	_, err = h.Register(MouseMove, nil, hit("move"))
+	tt.Nil(t, err)
+
+	evs := make(chan Event)
+	out := h.Process(evs)
+	press := func(es ...Event) []string {
+		got = nil
+		for _, e := range es {
+			evs <- e
+		}
+		evs <- Event{Kind: HookEnabled} // wait for the last dispatch
+		return got
+	}
+	key := func(kind uint8, k string) Event { return Event{Kind: kind, Keycode: Keycode[k]} }
+	btn := func(kind uint8, b string) Event { return Event{Kind: kind, Button: MouseMap[b]} }
+	wheel := func(rot int32) Event {
+		return Event{Kind: MouseWheel, Direction: wheelVertical, Rotation: rot}
+	}
+
+	tt.Equal(t, []string{"ctrl+click"}, press(key(KeyDown, "ctrl"),
+		btn(MouseDown, "left"), btn(MouseUp, "left"), key(KeyUp, "ctrl")))
+	tt.Equal(t, 0, len(press(btn(MouseDown, "left"), btn(MouseUp, "left"))))
+	tt.Equal(t, []string{"chord"}, press(btn(MouseDown, "right"),
+		btn(MouseDown, "left"), btn(MouseUp, "left"), btn(MouseUp, "right")))
+	// libuiohook releases a button with MouseHold, followed by MouseUp only
+	// if the button did not drag.
+	tt.Equal(t, 0, len(press(btn(MouseDown, "right"), Event{Kind: MouseDrag},
+		btn(MouseHold, "right"), btn(MouseDown, "left"), btn(MouseHold, "left"),
+		btn(MouseUp, "left"))))
+
+	tt.Equal(t, []string{"alt+wheelup"}, press(key(KeyDown, "alt"),
+		wheel(WheelUp), wheel(WheelDown), key(KeyUp, "alt")))
+	tt.Equal(t, 0, len(press(wheel(WheelUp))))
+
+	// A binding with no keys fires on every event of its kind.
+	tt.Equal(t, []string{"move", "move"},
+		press(Event{Kind: MouseMove}, Event{Kind: MouseMove}))
+
+	close(evs)
+	<-out
+}
@@ -0,0 +1,199 @@
+// Copyright 2016 The go-vgo Project Developers. See the COPYRIGHT
+// file at the top-level directory of this distribution and at
+// https://github.com/go-vgo/robotgo/blob/master/LICENSE
+//
+// Licensed under the Apache License, Version 2.0 <LICENSE-APACHE or
+// http://www.apache.org/licenses/LICENSE-2.0> or the MIT license
+// <LICENSE-MIT or http://opensource.org/licenses/MIT>, at your
+// option. This file may not be copied, modified, or distributed
+// except according to those terms.
+
+package hook
+
+import (
+	"slices"
+	"sync"
+	"time"
+)
+
+// IdleOptions configures an IdleMonitor.
+type IdleOptions struct {
+	// Kinds are the event kinds that count as activity. The default is
+	// every key, button, wheel and motion event.
+	Kinds []uint8
+	// MinMove ignores pointer motion until the pointer has moved more than
+	// MinMove pixels on either axis, so a jiggling mouse stays idle.
+	MinMove int
+	// Clock times the idle periods.
+	Clock Clock
+}
+
+// activityKinds are the default IdleOptions.Kinds.
+var activityKinds = []uint8{KeyDown, KeyHold, KeyUp,
+	MouseDown, MouseHold, MouseUp, MouseMove, MouseDrag, MouseWheel}
+
+type idleWatch struct {
+	d     time.Duration
+	cb    func()
+	fired bool
+	timer Timer
+}
+
+// IdleMonitor reports when the user has been idle for a while and when they
+// become active again, from the events Start delivers.
+//
+// Idle callbacks run on a Clock timer goroutine, OnActive callbacks on the
+// goroutine calling Feed.
+type IdleMonitor struct {
+	opts  IdleOptions
+	clock Clock
+
+	mu      sync.Mutex
+	last    time.Time
+	anchor  Event // where the pointer last counted as moving
+	moved   bool
+	watches []*idleWatch
+	active  []func(Event)
+	stopped bool
+}
+
+// NewIdleMonitor returns an IdleMonitor that takes the user as active now.
+func NewIdleMonitor(opts IdleOptions) *IdleMonitor {
+	if opts.Kinds == nil {
+		opts.Kinds = activityKinds
+	}
+
+	m := &IdleMonitor{opts: opts, clock: clockOr(opts.Clock)}
+	m.last = m.clock.Now()
+	return m
+}
+
+// OnIdle runs cb once no activity has been seen for d, and again after
+// each later activity is followed by d of idleness.
+func (m *IdleMonitor) OnIdle(d time.Duration, cb func()) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	w := &idleWatch{d: d, cb: cb}
+	m.watches = append(m.watches, w)
+	m.arm(w)
+}
+
+// OnActive runs cb on the first activity after an OnIdle callback fired.
+func (m *IdleMonitor) OnActive(cb func(Event)) {
+	m.mu.Lock()
+	m.active = append(m.active, cb)
+	m.mu.Unlock()
+}
+
+// LastInputTime returns the time of the last activity, or of the monitor's
+// creation if there was none.
+func (m *IdleMonitor) LastInputTime() time.Time {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.last
+}
+
+// Stop cancels the pending idle timers. The monitor reports nothing after
+// Stop.
+func (m *IdleMonitor) Stop() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.stopped = true
+	for _, w := range m.watches {
+		if w.timer != nil {
+			w.timer.Stop()
+		}
+	}
+}
+
+// Process runs Feed on the events read from evChan, and signals out once
+// evChan is closed.
+func (m *IdleMonitor) Process(evChan <-chan Event) (out chan bool) {
+	return feedAll(evChan, m.Feed, nil)
+}
+
+// Feed passes one event to the monitor.
+func (m *IdleMonitor) Feed(ev Event) {
+	if !slices.Contains(m.opts.Kinds, ev.Kind) {
+		return
+	}
+	at := ev.When
+	if at.IsZero() {
+		at = m.clock.Now()
+	}
+
+	var active []func(Event)
+	m.mu.Lock()
+	if m.stopped || !m.counts(ev) {
+		m.mu.Unlock()
+		return
+	}
+
+	m.last = at
+	for _, w := range m.watches {
+		if w.fired {
+			w.fired = false
+			active = m.active
+			m.arm(w)
+		}
+	}
+	m.mu.Unlock()
+
+	for _, cb := range active {
+		cb(ev)
+	}
+}
+
+// counts reports whether ev is activity, applying the MinMove threshold to
+// pointer motion.
+func (m *IdleMonitor) counts(ev Event) bool {
+	if ev.Kind != MouseMove && ev.Kind != MouseDrag {
+		return true
+	}
+	if !m.moved {
+		// The first sample only places the pointer.
+		m.anchor, m.moved = ev, true
+		return m.opts.MinMove <= 0
+	}
+
+	dx, dy := int(ev.X)-int(m.anchor.X), int(ev.Y)-int(m.anchor.Y)
+	if max(dx, -dx, dy, -dy) <= m.opts.MinMove {
+		return false
+	}
+	m.anchor = ev
+	return true
+}
+
+// arm sets w's timer for the end of its idle period.
+func (m *IdleMonitor) arm(w *idleWatch) {
+	if m.stopped {
+		return
+	}
+	if w.timer != nil {
+		w.timer.Stop()
+	}
+
+	d := w.d - m.clock.Now().Sub(m.last)
+	w.timer = m.clock.AfterFunc(d, func() { m.check(w) })
+}
+
+// check fires w if its idle period is over, or re-arms it when activity
+// since arming pushed the deadline back.
+func (m *IdleMonitor) check(w *idleWatch) {
+	m.mu.Lock()
+	if m.stopped || w.fired {
+		m.mu.Unlock()
+		return
+	}
+	if m.clock.Now().Sub(m.last) < w.d {
+		m.arm(w)
+		m.mu.Unlock()
+		return
+	}
+	w.fired = true
+	m.mu.Unlock()
+
+	w.cb()
+}
@@ -0,0 +1,50 @@
+package hook
+
+import (
+	"testing"
+	"time"
+
+	"github.com/vcaesar/tt"
+)
+
+func TestIdleMonitor(t *testing.T) {
+	clock := &fakeClock{now: time.Unix(1e9, 0)}
+	m := NewIdleMonitor(IdleOptions{MinMove: 3, Clock: clock})
+	defer m.Stop()
+
+	rec := &recorder{}
+	m.OnIdle(time.Minute, func() { rec.note("idle") })
+	m.OnActive(rec.hit("active"))
+	feed := func(e Event) {
+		e.When = clock.Now()
+		m.Feed(e)
+	}
+
+	clock.Advance(30 * time.Second)
+	feed(Event{Kind: KeyDown})
+	tt.Equal(t, clock.Now(), m.LastInputTime())
+	clock.Advance(59 * time.Second)
+	tt.Equal(t, 0, len(rec.got))
+	clock.Advance(time.Second)
+	tt.Equal(t, []string{"idle"}, rec.got)
+
+	// Jiggling the mouse, or hook status events, is no activity.
+	feed(Event{Kind: MouseMove, X: 100, Y: 100})
+	feed(Event{Kind: MouseMove, X: 102, Y: 98})
+	feed(Event{Kind: HookEnabled})
+	tt.Equal(t, []string{"idle"}, rec.got)
+
+	feed(Event{Kind: MouseMove, X: 104, Y: 100})
+	tt.Equal(t, []string{"idle", "active"}, rec.got)
+	clock.Advance(time.Minute)
+	tt.Equal(t, []string{"idle", "active", "idle"}, rec.got)
+
+	// Only the configured kinds count.
+	k := NewIdleMonitor(IdleOptions{Kinds: []uint8{KeyDown}, Clock: clock})
+	before := k.LastInputTime()
+	clock.Advance(time.Second)
+	k.Feed(Event{Kind: MouseDown, When: clock.Now()})
+	tt.Equal(t, before, k.LastInputTime())
+	k.Feed(Event{Kind: KeyDown, When: clock.Now()})
+	tt.Equal(t, clock.Now(), k.LastInputTime())
+}
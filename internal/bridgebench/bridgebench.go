@@ -0,0 +1,183 @@
+// Copyright 2016 The go-vgo Project Developers. See the COPYRIGHT
+// file at the top-level directory of this distribution and at
+// https://github.com/go-vgo/robotgo/blob/master/LICENSE
+//
+// Licensed under the Apache License, Version 2.0 <LICENSE-APACHE or
+// http://www.apache.org/licenses/LICENSE-2.0> or the MIT license
+// <LICENSE-MIT or http://opensource.org/licenses/MIT>, at your
+// option. This file may not be copied, modified, or distributed
+// except according to those terms.
+
+// Package bridgebench builds the cgo backend's bridge from dispatch_proc
+// to Go (event/ring.h) without libuiohook, next to the JSON bridge it
+// replaced, so the two can be timed without a display.
+package bridgebench
+
+/*
+#cgo linux CFLAGS: -std=gnu99
+#cgo linux LDFLAGS: -lpthread
+
+#include <stdlib.h>
+#include <inttypes.h>
+#include "../../event/ring.h"
+
+// json_queue stands in for the JSON bridge's eb_chan: a lock-free queue,
+// of the same size, of the strings dispatch_json formats.
+#define JSON_SIZE 1024
+static char *json_queue[JSON_SIZE];
+static uint32_t json_head = 0;
+static uint32_t json_tail = 0;
+
+// dispatch_json is the JSON bridge's dispatch_proc, for wheel events.
+static void dispatch_json(iohook_event * const event) {
+	char* buffer = calloc(200, sizeof(char));
+	sprintf(buffer,
+		"{\"id\":%i,\"time\":%" PRIu64 ",\"mask\":%hu,\"reserved\":%hu,\"clicks\":%hu,\"x\":%hd,\"y\":%hd,\"type\":%d,\"ammount\":%hu,\"rotation\":%d,\"direction\":%d}",
+		event->type, event->time, event->mask, event->reserved,
+		event->data.wheel.clicks,
+		event->data.wheel.x,
+		event->data.wheel.y,
+		event->data.wheel.type,
+		event->data.wheel.amount,
+		event->data.wheel.rotation,
+		event->data.wheel.direction);
+
+	uint32_t head = __atomic_load_n(&json_head, __ATOMIC_RELAXED);
+	if (head - __atomic_load_n(&json_tail, __ATOMIC_ACQUIRE) >= JSON_SIZE) {
+		free(buffer);
+		return;
+	}
+	json_queue[head % JSON_SIZE] = buffer;
+	__atomic_store_n(&json_head, head + 1, __ATOMIC_RELEASE);
+}
+
+// take_json takes the oldest queued string, or NULL.
+static char *take_json() {
+	uint32_t tail = __atomic_load_n(&json_tail, __ATOMIC_RELAXED);
+	if (tail == __atomic_load_n(&json_head, __ATOMIC_ACQUIRE)) {
+		return NULL;
+	}
+	char *s = json_queue[tail % JSON_SIZE];
+	__atomic_store_n(&json_tail, tail + 1, __ATOMIC_RELEASE);
+	return s;
+}
+
+// dispatch_wheel hands a wheel event to a bridge, as libuiohook's hook
+// thread would.
+static void dispatch_wheel(bool json) {
+	iohook_event ev = { 0 };
+	ev.type = EVENT_MOUSE_WHEEL;
+	ev.time = 1500;
+	ev.data.wheel.clicks = 1;
+	ev.data.wheel.x = 640;
+	ev.data.wheel.y = 360;
+	ev.data.wheel.type = WHEEL_UNIT_SCROLL;
+	ev.data.wheel.amount = 3;
+	ev.data.wheel.rotation = -1;
+	ev.data.wheel.direction = WHEEL_VERTICAL_DIRECTION;
+	if (json) {
+		dispatch_json(&ev);
+	} else {
+		dispatch_proc(&ev);
+	}
+}
+*/
+import "C"
+
+import (
+	"encoding/json"
+	"sync/atomic"
+	"time"
+	"unsafe"
+)
+
+// Event holds the fields of a wheel event, named as in hook.Event.
+type Event struct {
+	Kind      uint8  `json:"id"`
+	OSTime    uint64 `json:"time"`
+	Mask      uint16 `json:"mask"`
+	Reserved  uint16 `json:"reserved"`
+	Clicks    uint16 `json:"clicks"`
+	X         int16  `json:"x"`
+	Y         int16  `json:"y"`
+	Amount    uint16 `json:"amount"`
+	Rotation  int32  `json:"rotation"`
+	Direction uint8  `json:"direction"`
+}
+
+// StartRing opens the ring and sends the events dispatch_proc queues to
+// out, as the cgo backend's poller does, until end is called.
+func StartRing(out chan<- Event) (end func()) {
+	C.start_poll()
+	polled := make(chan struct{})
+	go func() {
+		defer close(polled)
+		var buf [64]C.go_event
+		for {
+			n := int(C.wait_events(&buf[0], C.int(len(buf))))
+			if n < 0 {
+				return
+			}
+			for i := range n {
+				c := &buf[i]
+				out <- Event{
+					Kind:      uint8(c._type),
+					OSTime:    uint64(c.time),
+					Mask:      uint16(c.mask),
+					Reserved:  uint16(c.reserved),
+					Clicks:    uint16(c.clicks),
+					X:         int16(c.x),
+					Y:         int16(c.y),
+					Amount:    uint16(c.amount),
+					Rotation:  int32(c.rotation),
+					Direction: uint8(c.direction),
+				}
+			}
+		}
+	}()
+
+	return func() {
+		C.endPoll()
+		<-polled
+	}
+}
+
+// DispatchRing queues a wheel event through dispatch_proc.
+func DispatchRing() {
+	C.dispatch_wheel(false)
+}
+
+// StartJSON drains the JSON queue every interval and sends the events it
+// decodes to out, as the cgo backend did before the ring, until end is
+// called.
+func StartJSON(out chan<- Event, interval time.Duration) (end func()) {
+	var stop atomic.Bool
+	polled := make(chan struct{})
+	go func() {
+		defer close(polled)
+		for !stop.Load() {
+			for s := C.take_json(); s != nil; s = C.take_json() {
+				str := []byte(C.GoString(s))
+				C.free(unsafe.Pointer(s))
+
+				var ev Event
+				if err := json.Unmarshal(str, &ev); err != nil {
+					panic(err)
+				}
+				out <- ev
+			}
+			time.Sleep(interval)
+		}
+	}()
+
+	return func() {
+		stop.Store(true)
+		<-polled
+	}
+}
+
+// DispatchJSON queues a wheel event through the JSON bridge's
+// dispatch_proc.
+func DispatchJSON() {
+	C.dispatch_wheel(true)
+}
@@ -0,0 +1,66 @@
+//go:build cgo
+
+package bridgebench
+
+import (
+	"math/rand/v2"
+	"testing"
+	"time"
+
+	"github.com/vcaesar/tt"
+)
+
+// jsonPoll is the JSON bridge's default poll interval.
+const jsonPoll = 50 * time.Millisecond
+
+func startJSON(out chan<- Event) func() {
+	return StartJSON(out, jsonPoll)
+}
+
+func TestBridges(t *testing.T) {
+	want := Event{Kind: 11, OSTime: 1500, Clicks: 1, X: 640, Y: 360,
+		Amount: 3, Rotation: -1, Direction: 3}
+
+	out := make(chan Event, 1)
+	end := StartRing(out)
+	DispatchRing()
+	tt.Equal(t, want, <-out)
+	end()
+
+	end = startJSON(out)
+	DispatchJSON()
+	got := <-out
+	end()
+	// the JSON bridge misspelt "amount", so the amount never arrived.
+	want.Amount = 0
+	tt.Equal(t, want, got)
+}
+
+// benchLatency times a wheel event from dispatch to its receive from out.
+// Events come at random points of the JSON bridge's poll interval, so
+// that bridge's wait averages out rather than locking to the poller.
+func benchLatency(b *testing.B, start func(chan<- Event) func(), dispatch func()) {
+	out := make(chan Event, 1)
+	end := start(out)
+	defer end()
+
+	for b.Loop() {
+		b.StopTimer()
+		time.Sleep(rand.N(jsonPoll))
+		b.StartTimer()
+
+		dispatch()
+		<-out
+	}
+}
+
+// BenchmarkLatencyRing times dispatch_proc, the ring and its woken poller.
+func BenchmarkLatencyRing(b *testing.B) {
+	benchLatency(b, StartRing, DispatchRing)
+}
+
+// BenchmarkLatencyJSON times the bridge the ring replaced: calloc and
+// sprintf, a lock-free queue, a 50 ms poll and json.Unmarshal.
+func BenchmarkLatencyJSON(b *testing.B) {
+	benchLatency(b, startJSON, DispatchJSON)
+}
@@ -0,0 +1,241 @@
+// Copyright 2016 The go-vgo Project Developers. See the COPYRIGHT
+// file at the top-level directory of this distribution and at
+// https://github.com/go-vgo/robotgo/blob/master/LICENSE
+//
+// Licensed under the Apache License, Version 2.0 <LICENSE-APACHE or
+// http://www.apache.org/licenses/LICENSE-2.0> or the MIT license
+// <LICENSE-MIT or http://opensource.org/licenses/MIT>, at your
+// option. This file may not be copied, modified, or distributed
+// except according to those terms.
+
+package hook
+
+import (
+	"expvar"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// RuntimeMetrics are the package's counters, see Metrics.
+type RuntimeMetrics struct {
+	// Events counts the events the backend delivered, by kind name.
+	Events map[string]uint64 `json:"events"`
+	// Dropped counts the events the Hooks lost, see Hook.Dropped.
+	Dropped uint64 `json:"dropped"`
+	// HighWater is the most events a Hook's channel has held.
+	HighWater int `json:"high_water"`
+	// Sessions counts the times the shared backend was started: by the
+	// first Hook, and again after the last Hook ended or the backend
+	// failed. The backends do not reconnect on their own.
+	Sessions uint64 `json:"sessions"`
+	// Bindings are the callbacks of the default Hook and the running ones.
+	Bindings []BindingInfo `json:"bindings"`
+}
+
+// BindingInfo describes a registered callback.
+type BindingInfo struct {
+	// Kind is the event kind that fires it, and Keys its keys and buttons
+	// as registered ("ctrl+q", "Ctrl+Q" for a hotkey, "Ctrl+X Ctrl+S" for
+	// a sequence).
+	Kind     string `json:"kind"`
+	Keys     string `json:"keys"`
+	Match    Match  `json:"match"`
+	Disabled bool   `json:"disabled"`
+	// Calls counts the callback runs and Time is their total duration.
+	Calls uint64        `json:"calls"`
+	Time  time.Duration `json:"time"`
+}
+
+// RuntimeSnapshot is the live state of a Hook, see Snapshot.
+type RuntimeSnapshot struct {
+	// Backend names the compiled-in backend: "libuiohook", "x11",
+	// "wayland", "windows" or "darwin".
+	Backend string `json:"backend"`
+	State   State  `json:"state"`
+	// Enabled reports that the shared backend is running and has sent
+	// HookEnabled, and Hooks is the number of Hooks sharing it.
+	Enabled bool `json:"enabled"`
+	Hooks   int  `json:"hooks"`
+
+	Bindings []BindingInfo `json:"bindings"`
+	// Pressed are the keys held as Process sees them, by Keycode name.
+	Pressed []string `json:"pressed"`
+}
+
+// metricsCounters back Metrics.
+type metricsCounters struct {
+	events    [32]atomic.Uint64
+	dropped   atomic.Uint64
+	highWater atomic.Int64
+	sessions  atomic.Uint64
+}
+
+var metrics metricsCounters
+
+func init() {
+	expvar.Publish("gohook", expvar.Func(func() any { return Metrics() }))
+}
+
+// fill records a channel holding n events.
+func (m *metricsCounters) fill(n int) {
+	for {
+		hw := m.highWater.Load()
+		if int64(n) <= hw || m.highWater.CompareAndSwap(hw, int64(n)) {
+			return
+		}
+	}
+}
+
+// Metrics returns the package's counters. They are also published through
+// expvar as "gohook".
+func Metrics() RuntimeMetrics {
+	m := RuntimeMetrics{
+		Events:    map[string]uint64{},
+		Dropped:   metrics.dropped.Load(),
+		HighWater: int(metrics.highWater.Load()),
+		Sessions:  metrics.sessions.Load(),
+	}
+	for kind := range metrics.events {
+		if n := metrics.events[kind].Load(); n > 0 {
+			m.Events[kindName(uint8(kind))] = n
+		}
+	}
+
+	hookMu.Lock()
+	hs := append([]*Hook{std}, hooks...)
+	hookMu.Unlock()
+
+	for i, h := range hs {
+		if i == 0 || h != std {
+			m.Bindings = append(m.Bindings, h.bindings()...)
+		}
+	}
+	return m
+}
+
+// Snapshot returns the live state of the default Hook, see Hook.Snapshot.
+func Snapshot() RuntimeSnapshot {
+	return std.Snapshot()
+}
+
+// Snapshot returns the Hook's live state: its bindings, the keys held and
+// the state of the Hook and the shared backend.
+func (h *Hook) Snapshot() RuntimeSnapshot {
+	s := RuntimeSnapshot{
+		Backend:  backendName,
+		State:    h.State(),
+		Bindings: h.bindings(),
+	}
+
+	hookMu.Lock()
+	s.Enabled = asyncon.Load() && enabled
+	s.Hooks = len(hooks)
+	hookMu.Unlock()
+
+	if keys := h.pressed.Load(); keys != nil {
+		for _, code := range *keys {
+			s.Pressed = append(s.Pressed, keyName(code))
+		}
+	}
+	return s
+}
+
+// bindings describes the Hook's registry.
+func (h *Hook) bindings() []BindingInfo {
+	r := h.reg.Load()
+
+	var out []BindingInfo
+	for _, kind := range slices.Sorted(maps.Keys(r.events)) {
+		for _, b := range r.events[kind] {
+			out = append(out, b.info())
+		}
+	}
+	for _, b := range r.seqs {
+		out = append(out, b.info())
+	}
+	return out
+}
+
+func (b *binding) info() BindingInfo {
+	keys := b.name
+	if b.seq != nil {
+		strokes := make([]string, len(b.seq))
+		for i, hk := range b.seq {
+			strokes[i] = hk.String()
+		}
+		keys = strings.Join(strokes, " ")
+	}
+
+	return BindingInfo{
+		Kind:     kindName(b.when),
+		Keys:     keys,
+		Match:    Match(b.match.Load()),
+		Disabled: b.off.Load(),
+		Calls:    b.calls.Load(),
+		Time:     time.Duration(b.busy.Load()),
+	}
+}
+
+// run calls the callback, timing it for Metrics.
+func (b *binding) run(ev Event) {
+	start := time.Now()
+	b.cb(ev)
+	b.busy.Add(int64(time.Since(start)))
+	b.calls.Add(1)
+}
+
+// setPressed publishes the keys Process sees held.
+func (h *Hook) setPressed(pressed map[uint16]bool) {
+	var keys []uint16
+	for code, down := range pressed {
+		if down {
+			keys = append(keys, code)
+		}
+	}
+	slices.Sort(keys)
+	h.pressed.Store(&keys)
+}
+
+// kindNames are the names of the event kinds.
+var kindNames = [...]string{
+	HookEnabled: "HookEnabled", HookDisabled: "HookDisabled",
+	KeyDown: "KeyDown", KeyHold: "KeyHold", KeyUp: "KeyUp",
+	MouseDown: "MouseDown", MouseHold: "MouseHold", MouseUp: "MouseUp",
+	MouseMove: "MouseMove", MouseDrag: "MouseDrag", MouseWheel: "MouseWheel",
+	FakeEvent: "FakeEvent",
+}
+
+func kindName(kind uint8) string {
+	if int(kind) < len(kindNames) && kindNames[kind] != "" {
+		return kindNames[kind]
+	}
+	return "Kind(" + strconv.Itoa(int(kind)) + ")"
+}
+
+var (
+	keyNamesOnce sync.Once
+	keyNames     map[uint16]string
+)
+
+// keyName returns the Keycode name of code, the shortest of its aliases.
+func keyName(code uint16) string {
+	keyNamesOnce.Do(func() {
+		keyNames = make(map[uint16]string, len(Keycode))
+		for name, c := range Keycode {
+			if o, ok := keyNames[c]; !ok || len(name) < len(o) ||
+				len(name) == len(o) && name < o {
+				keyNames[c] = name
+			}
+		}
+	})
+
+	if name, ok := keyNames[code]; ok {
+		return name
+	}
+	return strconv.Itoa(int(code))
+}
@@ -0,0 +1,70 @@
+package hook
+
+import (
+	"encoding/json"
+	"expvar"
+	"testing"
+
+	"github.com/vcaesar/tt"
+)
+
+func TestSnapshot(t *testing.T) {
+	h := New(Options{})
+	_, err := h.Register(KeyDown, []string{"ctrl", "q"}, func(Event) {})
+	tt.Nil(t, err)
+	_, err = h.RegisterHotkey("Ctrl+Shift+S", func(Event) {})
+	tt.Nil(t, err)
+	b, err := h.RegisterSequence([]Hotkey{{Mods: ModCtrl, Key: "x"},
+		{Mods: ModCtrl, Key: "s"}}, 0, func(Event) {})
+	tt.Nil(t, err)
+	b.Disable()
+
+	ch := make(chan Event)
+	out := h.Process(ch)
+	ch <- Event{Kind: KeyDown, Keycode: Keycode["ctrl"]}
+	ch <- Event{Kind: KeyDown, Keycode: Keycode["q"]}
+	ch <- Event{Kind: KeyUp, Keycode: Keycode["q"]}
+	ch <- Event{Kind: MouseMove} // the KeyUp has been handled
+
+	s := h.Snapshot()
+	tt.Equal(t, backendName, s.Backend)
+	tt.Equal(t, Idle, s.State)
+	tt.Equal(t, []string{keyName(Keycode["ctrl"])}, s.Pressed)
+	tt.Equal(t, 3, len(s.Bindings))
+	tt.Equal(t, BindingInfo{Kind: "KeyDown", Keys: "ctrl+q", Calls: 1,
+		Time: s.Bindings[0].Time}, s.Bindings[0])
+	tt.Equal(t, "Ctrl+Shift+S", s.Bindings[1].Keys)
+	tt.Equal(t, Exact, s.Bindings[1].Match)
+	tt.Equal(t, "Ctrl+X Ctrl+S", s.Bindings[2].Keys)
+	tt.True(t, s.Bindings[2].Disabled)
+
+	close(ch)
+	<-out
+	tt.Equal(t, 0, len(h.Snapshot().Pressed))
+}
+
+func TestMetrics(t *testing.T) {
+	h, _ := runningHook(Options{Buffer: 4})
+	for range 5 {
+		h.push(Event{Kind: KeyDown, Keycode: Keycode["a"]})
+	}
+
+	s := New(Options{})
+	s.Start()
+	s.End()
+
+	m := Metrics()
+	tt.True(t, m.HighWater >= 4)
+	tt.True(t, m.Dropped >= 1)
+	tt.True(t, m.Sessions >= 1)
+
+	v := expvar.Get("gohook")
+	tt.NotNil(t, v)
+	var got RuntimeMetrics
+	tt.Nil(t, json.Unmarshal([]byte(v.String()), &got))
+	tt.True(t, got.Dropped >= 1)
+
+	tt.Equal(t, "MouseWheel", kindName(MouseWheel))
+	tt.Equal(t, "Kind(40)", kindName(40))
+	tt.Equal(t, "a", keyName(Keycode["a"]))
+}
@@ -0,0 +1,164 @@
+// Copyright 2016 The go-vgo Project Developers. See the COPYRIGHT
+// file at the top-level directory of this distribution and at
+// https://github.com/go-vgo/robotgo/blob/master/LICENSE
+//
+// Licensed under the Apache License, Version 2.0 <LICENSE-APACHE or
+// http://www.apache.org/licenses/LICENSE-2.0> or the MIT license
+// <LICENSE-MIT or http://opensource.org/licenses/MIT>, at your
+// option. This file may not be copied, modified, or distributed
+// except according to those terms.
+
+package hook
+
+import (
+	"sync"
+	"time"
+)
+
+// MotionPolicy is how a Hook reports pointer motion, see Options.Motion.
+type MotionPolicy uint8
+
+const (
+	// MotionAll reports every MouseMove and MouseDrag sample while the
+	// channel has room for motion.
+	MotionAll MotionPolicy = iota
+	// MotionCoalesce holds motion back while the channel has unread events
+	// and then reports the samples that arrived meanwhile as one event at
+	// the latest position.
+	MotionCoalesce
+	// MotionThrottle reports at most Options.MotionRate motion events per
+	// second, each merging the samples since the previous one.
+	MotionThrottle
+)
+
+const (
+	// motionRetry is how often merged motion retries while it cannot be
+	// delivered.
+	motionRetry = 10 * time.Millisecond
+
+	defaultMotionRate = 60
+)
+
+// motionState merges a Hook's pointer motion under its MotionPolicy.
+type motionState struct {
+	mu sync.Mutex
+
+	pending Event // merged motion not delivered yet, if has
+	has     bool
+
+	// x, y is where the last delivered motion left the pointer, if moved,
+	// and last when it was delivered.
+	x, y  int16
+	moved bool
+	last  time.Time
+	timer Timer
+}
+
+// reset drops the pending motion of a previous session.
+func (m *motionState) reset() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.timer != nil {
+		m.timer.Stop()
+	}
+	m.pending, m.has = Event{}, false
+	m.x, m.y, m.moved = 0, 0, false
+	m.last, m.timer = time.Time{}, nil
+}
+
+// pushMotion merges a MouseMove or MouseDrag into the pending motion and
+// delivers it if the policy allows. h.mu must be held for reading.
+func (h *Hook) pushMotion(e Event) {
+	m := &h.motion
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	e.Samples = 1
+	if m.has {
+		e.Samples += m.pending.Samples
+		// A drag merged with later moves is still a drag.
+		if m.pending.Kind == MouseDrag {
+			e.Kind = MouseDrag
+		}
+	}
+	m.pending, m.has = e, true
+	h.sendMotion(false)
+}
+
+// flushMotion delivers the pending motion ahead of a key or button event,
+// so that they keep their order. h.mu must be held for reading.
+func (h *Hook) flushMotion() {
+	m := &h.motion
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	h.sendMotion(true)
+}
+
+// motionTimer retries the pending motion.
+func (h *Hook) motionTimer() {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	m := &h.motion
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.timer = nil
+	if h.state == Starting || h.state == Running {
+		h.sendMotion(false)
+	}
+}
+
+// sendMotion delivers the pending motion, or schedules a retry. Motion
+// fills at most three quarters of the channel, keeping the rest for key
+// and button events; ahead of one (flush), it may take any slot but the
+// last, and ignores MotionRate. m.mu must be held.
+func (h *Hook) sendMotion(flush bool) {
+	m := &h.motion
+	if !m.has {
+		return
+	}
+
+	now := h.clock.Now()
+	n, room := len(h.ev), cap(h.ev)-cap(h.ev)/4
+	if flush {
+		room = cap(h.ev) - 1
+	}
+	ready := n < room
+
+	switch h.opts.Motion {
+	case MotionCoalesce:
+		ready = ready && (flush || n == 0)
+	case MotionThrottle:
+		rate := h.opts.MotionRate
+		if rate <= 0 {
+			rate = defaultMotionRate
+		}
+		if next := m.last.Add(time.Second / time.Duration(rate)); !flush && now.Before(next) {
+			h.retryMotion(next.Sub(now))
+			return
+		}
+	}
+
+	e := m.pending
+	if m.moved {
+		e.DX, e.DY = int32(e.X)-int32(m.x), int32(e.Y)-int32(m.y)
+	}
+	if !ready || !h.offer(e) {
+		h.retryMotion(motionRetry)
+		return
+	}
+
+	m.has = false
+	m.x, m.y, m.moved = e.X, e.Y, true
+	m.last = now
+}
+
+// retryMotion calls sendMotion again after d; m.mu must be held.
+func (h *Hook) retryMotion(d time.Duration) {
+	if h.motion.timer == nil {
+		h.motion.timer = h.clock.AfterFunc(d, h.motionTimer)
+	}
+}
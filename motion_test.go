@@ -0,0 +1,111 @@
+package hook
+
+import (
+	"testing"
+	"time"
+
+	"github.com/vcaesar/tt"
+)
+
+// runningHook returns a running Hook with no backend and a fake clock.
+func runningHook(opts Options) (*Hook, *fakeClock) {
+	clock := &fakeClock{now: time.Unix(1e9, 0)}
+	h := New(opts)
+	h.clock = clock
+	h.state = Running
+	h.ev = make(chan Event, max(opts.Buffer, 1))
+	if opts.Policy == Block {
+		h.blocked = h.newBlockQueue()
+	}
+	return h, clock
+}
+
+func move(x, y int16) Event {
+	return Event{Kind: MouseMove, X: x, Y: y}
+}
+
+func TestMotionCoalesce(t *testing.T) {
+	h, clock := runningHook(Options{Motion: MotionCoalesce, Buffer: 8})
+
+	h.push(move(1, 1))
+	h.push(move(3, 2))
+	h.push(move(5, 5))
+	e := <-h.ev
+	tt.Equal(t, uint16(1), e.Samples)
+	tt.Equal(t, int32(0), e.DX)
+	tt.Equal(t, 0, len(h.ev))
+
+	clock.Advance(motionRetry)
+	e = <-h.ev
+	tt.Equal(t, int16(5), e.X)
+	tt.Equal(t, uint16(2), e.Samples)
+	tt.Equal(t, int32(4), e.DX)
+	tt.Equal(t, int32(4), e.DY)
+
+	// A key event brings the pending motion along, in order.
+	h.push(move(6, 5))
+	h.push(move(7, 7))
+	h.push(Event{Kind: KeyDown, Keycode: Keycode["a"]})
+	tt.Equal(t, int16(6), (<-h.ev).X)
+	e = <-h.ev
+	tt.Equal(t, int16(7), e.X)
+	tt.Equal(t, int32(1), e.DX)
+	tt.Equal(t, KeyDown, int((<-h.ev).Kind))
+
+	// A drag merged with a later move stays a drag.
+	h.push(move(8, 7))
+	h.push(Event{Kind: MouseDrag, X: 9, Y: 7})
+	h.push(move(10, 7))
+	tt.Equal(t, MouseMove, int((<-h.ev).Kind))
+	clock.Advance(motionRetry)
+	e = <-h.ev
+	tt.Equal(t, MouseDrag, int(e.Kind))
+	tt.Equal(t, uint16(2), e.Samples)
+}
+
+func TestMotionThrottle(t *testing.T) {
+	h, clock := runningHook(Options{Motion: MotionThrottle, MotionRate: 10, Buffer: 8})
+
+	h.push(move(0, 0))
+	clock.Advance(10 * time.Millisecond)
+	h.push(move(1, 0))
+	clock.Advance(10 * time.Millisecond)
+	h.push(move(2, 0))
+	tt.Equal(t, 1, len(h.ev))
+
+	clock.Advance(80 * time.Millisecond)
+	tt.Equal(t, 2, len(h.ev))
+	<-h.ev
+	e := <-h.ev
+	tt.Equal(t, uint16(2), e.Samples)
+	tt.Equal(t, int32(2), e.DX)
+
+	// A key event brings the throttled motion along, in order.
+	h.push(move(3, 0))
+	h.push(Event{Kind: KeyDown, Keycode: Keycode["a"]})
+	tt.Equal(t, 2, len(h.ev))
+	tt.Equal(t, int16(3), (<-h.ev).X)
+	tt.Equal(t, KeyDown, int((<-h.ev).Kind))
+}
+
+func TestMotionPressure(t *testing.T) {
+	h, clock := runningHook(Options{Buffer: 4})
+
+	for i := int16(1); i <= 10; i++ {
+		h.push(move(i, 0))
+	}
+	tt.Equal(t, 3, len(h.ev))
+
+	h.push(Event{Kind: KeyDown, Keycode: Keycode["a"]})
+	tt.Equal(t, 4, len(h.ev))
+	for i := int16(1); i <= 3; i++ {
+		tt.Equal(t, i, (<-h.ev).X)
+	}
+	tt.Equal(t, KeyDown, int((<-h.ev).Kind))
+
+	clock.Advance(motionRetry)
+	e := <-h.ev
+	tt.Equal(t, int16(10), e.X)
+	tt.Equal(t, uint16(7), e.Samples)
+	tt.Equal(t, int32(7), e.DX)
+}
@@ -0,0 +1,78 @@
+// Copyright 2016 The go-vgo Project Developers. See the COPYRIGHT
+// file at the top-level directory of this distribution and at
+// https://github.com/go-vgo/robotgo/blob/master/LICENSE
+//
+// Licensed under the Apache License, Version 2.0 <LICENSE-APACHE or
+// http://www.apache.org/licenses/LICENSE-2.0> or the MIT license
+// <LICENSE-MIT or http://opensource.org/licenses/MIT>, at your
+// option. This file may not be copied, modified, or distributed
+// except according to those terms.
+
+package hook
+
+import (
+	"sync"
+	"time"
+)
+
+// maxOSLag is how far an event may arrive after its timestamp before
+// osClock decides the OS clock has fallen behind the wall clock.
+const maxOSLag = time.Second
+
+// osClock maps a backend's raw event timestamps (Event.OSTime) onto the
+// wall clock.
+//
+// The raw clock has no known epoch, so the offset between the two clocks is
+// taken from the event that arrived soonest after its timestamp: the
+// smallest difference seen. A raw clock that fell behind by more than
+// maxOSLag, as one that stops during a suspend, is anchored again.
+type osClock struct {
+	// numer/denom is the length of a raw tick in nanoseconds; wrap means
+	// the raw clock is a 32-bit counter.
+	numer, denom uint64
+	wrap         bool
+
+	mu       sync.Mutex
+	last     uint64 // last 32-bit raw value, and high the wraps seen
+	high     uint64
+	offset   int64 // wall clock minus raw clock, in nanoseconds
+	anchored bool
+}
+
+// newOSClock returns an osClock for raw ticks of numer/denom nanoseconds,
+// counted in 32 bits if wrap is set.
+func newOSClock(numer, denom uint64, wrap bool) *osClock {
+	return &osClock{numer: numer, denom: denom, wrap: wrap}
+}
+
+// reset forgets the offset, for a new backend session.
+func (c *osClock) reset() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.last, c.high = 0, 0
+	c.offset, c.anchored = 0, false
+}
+
+// when returns the time of an event stamped raw that the backend sent at
+// now. The result keeps now's monotonic reading.
+func (c *osClock) when(raw uint64, now time.Time) time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.wrap {
+		raw &= 1<<32 - 1
+		if c.anchored && raw < c.last && c.last-raw > 1<<31 {
+			c.high += 1 << 32
+		}
+		c.last = raw
+		raw += c.high
+	}
+
+	ns := int64(raw/c.denom*c.numer + raw%c.denom*c.numer/c.denom)
+	diff := now.UnixNano() - ns
+	if !c.anchored || diff < c.offset || diff-c.offset > int64(maxOSLag) {
+		c.offset, c.anchored = diff, true
+	}
+	return now.Add(-time.Duration(diff - c.offset))
+}
@@ -0,0 +1,56 @@
+package hook
+
+import (
+	"testing"
+	"time"
+
+	"github.com/vcaesar/tt"
+)
+
+func TestOSClock(t *testing.T) {
+	c := newOSClock(1e6, 1, true)
+	t0 := time.Unix(1e9, 0)
+	ms := time.Millisecond
+
+	tt.Equal(t, t0.Add(5*ms), c.when(1000, t0.Add(5*ms)))
+	// Sooner after its timestamp: the offset moves.
+	tt.Equal(t, t0.Add(12*ms), c.when(1010, t0.Add(12*ms)))
+	// Later: the event happened before it arrived.
+	tt.Equal(t, t0.Add(22*ms), c.when(1020, t0.Add(30*ms)))
+
+	// The 32-bit counter wraps.
+	c.reset()
+	tt.Equal(t, t0, c.when(1<<32-16, t0))
+	tt.Equal(t, t0.Add(32*ms), c.when(16, t0.Add(40*ms)))
+
+	// A clock stopped by a suspend is anchored again.
+	tt.Equal(t, t0.Add(time.Hour), c.when(20, t0.Add(time.Hour)))
+	tt.Equal(t, t0.Add(time.Hour+ms), c.when(21, t0.Add(time.Hour+ms)))
+
+	// mach_absolute_time ticks of 125/3 ns.
+	m := newOSClock(125, 3, false)
+	tt.Equal(t, t0, m.when(24e6, t0))
+	tt.Equal(t, t0.Add(ms), m.when(24e6+24e3, t0.Add(2*ms)))
+}
+
+func TestSendTimes(t *testing.T) {
+	h := New(Options{Kinds: []uint8{KeyDown, KeyUp}})
+	evs := h.Start()
+	defer h.End()
+
+	send(Event{Kind: KeyDown, OSTime: 5000})
+	send(Event{Kind: KeyUp, OSTime: 5100})
+
+	var got []Event
+	for e := range evs {
+		if e.Kind == KeyDown || e.Kind == KeyUp {
+			got = append(got, e)
+			if len(got) == 2 {
+				break
+			}
+		}
+	}
+	tt.Equal(t, uint64(5100), got[1].OSTime)
+	tt.True(t, got[1].Seq > got[0].Seq)
+	tt.False(t, got[1].When.IsZero())
+}
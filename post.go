@@ -0,0 +1,127 @@
+// Copyright 2016 The go-vgo Project Developers. See the COPYRIGHT
+// file at the top-level directory of this distribution and at
+// https://github.com/go-vgo/robotgo/blob/master/LICENSE
+//
+// Licensed under the Apache License, Version 2.0 <LICENSE-APACHE or
+// http://www.apache.org/licenses/LICENSE-2.0> or the MIT license
+// <LICENSE-MIT or http://opensource.org/licenses/MIT>, at your
+// option. This file may not be copied, modified, or distributed
+// except according to those terms.
+
+package hook
+
+import (
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+)
+
+// Post sends a synthetic event into the system, as if it came from the
+// keyboard or mouse. Running Hooks receive it like any other event.
+//
+// The fields used are those the backend fills in its own events:
+//   - KeyDown and KeyUp press and release Keycode.
+//   - MouseDown and MouseUp press and release Button at X, Y.
+//   - MouseMove and MouseDrag move the pointer to X, Y.
+//   - MouseWheel scrolls Rotation notches at X, Y, up or left when
+//     negative, along Direction (vertical when 0).
+//
+// Other kinds return ErrNotSupported. Mask is applied by the cgo backend
+// only; post the modifier keys themselves to be portable.
+//
+// The cgo backend posts through libuiohook's hook_post_event and needs no
+// running Hook. The pure-Go X11 backend posts through the XTEST extension
+// on the running hook's connection and returns ErrNotRunning when no Hook
+// is running. The other pure-Go backends return ErrNotSupported.
+//
+// Hooks receive posted events with Synthetic set and Source SourceSelf;
+// the cgo backend matches them up heuristically, see Event.Source.
+func Post(ev Event) error {
+	switch ev.Kind {
+	case KeyDown, KeyUp, MouseDown, MouseUp, MouseMove, MouseDrag:
+	case MouseWheel:
+		if ev.Direction == 0 {
+			ev.Direction = wheelVertical
+		}
+	default:
+		return fmt.Errorf("%w: cannot post event kind %d", ErrNotSupported, ev.Kind)
+	}
+
+	return postEvent(ev)
+}
+
+// postedTTL bounds how long a posted event waits to come back.
+const postedTTL = time.Second
+
+// postLog remembers the events Post sent on a backend that cannot tell
+// injected input from a device's, so that the backend can tag them as
+// SourceSelf when they come back.
+type postLog struct {
+	mu    sync.Mutex
+	evs   []postedEvent
+	typed bool // the next typed event follows a posted KeyDown
+}
+
+type postedEvent struct {
+	ev Event
+	at time.Time
+}
+
+var posted postLog
+
+// add expects ev to come back. It prunes the log too, since Post works
+// with no Hook running to tag the events.
+func (l *postLog) add(ev Event, now time.Time) {
+	l.mu.Lock()
+	l.prune(now)
+	l.evs = append(l.evs, postedEvent{ev: ev, at: now})
+	l.mu.Unlock()
+}
+
+// prune forgets the events that did not come back within postedTTL; l.mu
+// must be held.
+func (l *postLog) prune(now time.Time) {
+	l.evs = slices.DeleteFunc(l.evs, func(p postedEvent) bool {
+		return now.Sub(p.at) > postedTTL
+	})
+}
+
+// tag marks e as SourceSelf if it is an expected event, which it then no
+// longer expects.
+func (l *postLog) tag(e Event, now time.Time) Event {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	typed := l.typed
+	l.typed = false
+	if typed && e.Kind == KeyHold && e.Keycode == 0 {
+		e.Synthetic, e.Source = true, SourceSelf
+		return e
+	}
+
+	l.prune(now)
+	for i, p := range l.evs {
+		if p.matches(e) {
+			l.evs = slices.Delete(l.evs, i, i+1)
+			l.typed = e.Kind == KeyDown
+			e.Synthetic, e.Source = true, SourceSelf
+			break
+		}
+	}
+	return e
+}
+
+func (p postedEvent) matches(e Event) bool {
+	switch e.Kind {
+	case KeyDown, KeyUp:
+		return p.ev.Kind == e.Kind && p.ev.Keycode == e.Keycode
+	case MouseDown, MouseHold, MouseUp:
+		return p.ev.Kind == e.Kind && p.ev.Button == e.Button
+	case MouseMove, MouseDrag:
+		// Moving with a button held comes back as a drag.
+		return (p.ev.Kind == MouseMove || p.ev.Kind == MouseDrag) &&
+			p.ev.X == e.X && p.ev.Y == e.Y
+	}
+	return p.ev.Kind == e.Kind
+}
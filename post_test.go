@@ -0,0 +1,63 @@
+package hook
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/vcaesar/tt"
+)
+
+func TestPostKind(t *testing.T) {
+	for _, kind := range []uint8{0, HookEnabled, HookDisabled, KeyHold, MouseHold, FakeEvent} {
+		err := Post(Event{Kind: kind})
+		tt.Equal(t, true, errors.Is(err, ErrNotSupported))
+	}
+}
+
+func TestPostLog(t *testing.T) {
+	var l postLog
+	now := time.Now()
+	a := Keycode["a"]
+
+	l.add(Event{Kind: KeyDown, Keycode: a}, now)
+	l.add(Event{Kind: MouseMove, X: 3, Y: 4}, now)
+
+	// Device input stays untagged.
+	e := l.tag(Event{Kind: KeyDown, Keycode: Keycode["b"]}, now)
+	tt.Equal(t, false, e.Synthetic)
+	tt.Equal(t, SourceDevice, e.Source)
+
+	e = l.tag(Event{Kind: KeyDown, Keycode: a}, now)
+	tt.Equal(t, true, e.Synthetic)
+	tt.Equal(t, SourceSelf, e.Source)
+	// So is the typed event that follows.
+	e = l.tag(Event{Kind: KeyHold, Keychar: 'a'}, now)
+	tt.Equal(t, SourceSelf, e.Source)
+	// Each posted event is tagged once.
+	e = l.tag(Event{Kind: KeyDown, Keycode: a}, now)
+	tt.Equal(t, SourceDevice, e.Source)
+
+	e = l.tag(Event{Kind: MouseDrag, X: 3, Y: 4}, now)
+	tt.Equal(t, SourceSelf, e.Source)
+
+	// Expectations expire.
+	l.add(Event{Kind: MouseWheel, Rotation: WheelUp}, now)
+	e = l.tag(Event{Kind: MouseWheel, Rotation: WheelUp}, now.Add(2*postedTTL))
+	tt.Equal(t, SourceDevice, e.Source)
+	tt.Equal(t, 0, len(l.evs))
+
+	// A device event matching a pending post takes its place: the match
+	// is a heuristic, see Event.Source.
+	l.add(Event{Kind: KeyUp, Keycode: a}, now)
+	e = l.tag(Event{Kind: KeyUp, Keycode: a}, now) // from the keyboard
+	tt.Equal(t, SourceSelf, e.Source)
+	e = l.tag(Event{Kind: KeyUp, Keycode: a}, now) // the posted one
+	tt.Equal(t, SourceDevice, e.Source)
+
+	// Posting with nothing tagging the events keeps the log bounded.
+	for i := range 100 {
+		l.add(Event{Kind: KeyDown, Keycode: a}, now.Add(time.Duration(i)*postedTTL))
+	}
+	tt.Equal(t, 2, len(l.evs))
+}
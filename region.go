@@ -0,0 +1,259 @@
+// Copyright 2016 The go-vgo Project Developers. See the COPYRIGHT
+// file at the top-level directory of this distribution and at
+// https://github.com/go-vgo/robotgo/blob/master/LICENSE
+//
+// Licensed under the Apache License, Version 2.0 <LICENSE-APACHE or
+// http://www.apache.org/licenses/LICENSE-2.0> or the MIT license
+// <LICENSE-MIT or http://opensource.org/licenses/MIT>, at your
+// option. This file may not be copied, modified, or distributed
+// except according to those terms.
+
+package hook
+
+import (
+	"image"
+	"math"
+	"sync"
+	"time"
+)
+
+// Corner is a corner of the screen, for HotCorner.
+type Corner uint8
+
+// Screen corners.
+const (
+	TopLeft Corner = iota
+	TopRight
+	BottomLeft
+	BottomRight
+)
+
+// Region kinds.
+const (
+	regionEnter = iota
+	regionLeave
+	regionDwell
+)
+
+type region struct {
+	kind int
+	rect image.Rectangle
+	d    time.Duration
+	cb   func(Event)
+
+	inside bool
+	stay   int // counts the stays, so a stale dwell timer can tell
+	timer  Timer
+}
+
+// Regions fires callbacks when the pointer enters, leaves or dwells in
+// screen rectangles, following the MouseMove and MouseDrag events. A fast
+// pointer is sampled sparsely, so the path between two samples is taken
+// as a straight line: a flick across a rectangle still enters and leaves
+// it, and the events passed to the callbacks carry the crossing point.
+//
+// Callbacks run on the goroutine calling Feed, or for dwells on a Clock
+// timer goroutine.
+type Regions struct {
+	screen image.Rectangle
+	clock  Clock
+
+	mu      sync.Mutex
+	regions []*region
+	last    Event
+	started bool
+}
+
+// RegionOptions configures a Regions.
+type RegionOptions struct {
+	// Screen is the screen bounds, used by HotCorner.
+	Screen image.Rectangle
+	// Clock times the dwells.
+	Clock Clock
+}
+
+// NewRegions returns a Regions with no triggers registered.
+func NewRegions(opts RegionOptions) *Regions {
+	return &Regions{screen: opts.Screen, clock: clockOr(opts.Clock)}
+}
+
+func (r *Regions) add(kind int, rect image.Rectangle, d time.Duration, cb func(Event)) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	g := &region{kind: kind, rect: rect, d: d, cb: cb}
+	if r.started {
+		g.inside = pointIn(r.last, rect)
+	}
+	r.regions = append(r.regions, g)
+}
+
+// OnEnterRect runs cb when the pointer enters rect.
+func (r *Regions) OnEnterRect(rect image.Rectangle, cb func(Event)) {
+	r.add(regionEnter, rect, 0, cb)
+}
+
+// OnLeaveRect runs cb when the pointer leaves rect.
+func (r *Regions) OnLeaveRect(rect image.Rectangle, cb func(Event)) {
+	r.add(regionLeave, rect, 0, cb)
+}
+
+// OnDwell runs cb once the pointer has stayed in rect for duration, and
+// again only after it has left and come back. cb receives the event that
+// entered rect.
+func (r *Regions) OnDwell(rect image.Rectangle, duration time.Duration, cb func(Event)) {
+	r.add(regionDwell, rect, duration, cb)
+}
+
+// HotCorner runs cb when the pointer stays in the size x size pixel square
+// at a corner of the screen for delay.
+func (r *Regions) HotCorner(corner Corner, size int, delay time.Duration, cb func(Event)) {
+	s := r.screen
+	rect := image.Rect(s.Min.X, s.Min.Y, s.Min.X+size, s.Min.Y+size)
+	switch corner {
+	case TopRight:
+		rect = image.Rect(s.Max.X-size, s.Min.Y, s.Max.X, s.Min.Y+size)
+	case BottomLeft:
+		rect = image.Rect(s.Min.X, s.Max.Y-size, s.Min.X+size, s.Max.Y)
+	case BottomRight:
+		rect = image.Rect(s.Max.X-size, s.Max.Y-size, s.Max.X, s.Max.Y)
+	}
+
+	r.OnDwell(rect, delay, cb)
+}
+
+// Process runs Feed on the events read from evChan, and signals out once
+// evChan is closed.
+func (r *Regions) Process(evChan <-chan Event) (out chan bool) {
+	return feedAll(evChan, r.Feed, nil)
+}
+
+// Feed passes one event to the region triggers.
+func (r *Regions) Feed(ev Event) {
+	if ev.Kind != MouseMove && ev.Kind != MouseDrag {
+		return
+	}
+	if ev.When.IsZero() {
+		ev.When = r.clock.Now()
+	}
+
+	var fire []func()
+	r.mu.Lock()
+	prev, started := r.last, r.started
+	r.last, r.started = ev, true
+	if !started {
+		prev = ev
+	}
+
+	for _, g := range r.regions {
+		in, out, ok := clip(prev, ev, g.rect)
+		now := pointIn(ev, g.rect)
+
+		if !g.inside && ok {
+			fire = append(fire, g.enter(r, lerp(prev, ev, in)))
+			g.inside = true
+		}
+		if g.inside && !now {
+			fire = append(fire, g.leave(lerp(prev, ev, out)))
+			g.inside = false
+		}
+	}
+	r.mu.Unlock()
+
+	for _, f := range fire {
+		if f != nil {
+			f()
+		}
+	}
+}
+
+// enter starts a stay of the pointer in g, returning the callback to run.
+func (g *region) enter(r *Regions, ev Event) func() {
+	g.stay++
+	switch g.kind {
+	case regionEnter:
+		return func() { g.cb(ev) }
+	case regionDwell:
+		if g.d <= 0 {
+			return func() { g.cb(ev) }
+		}
+
+		stay := g.stay
+		d := g.d - r.clock.Now().Sub(ev.When)
+		g.timer = r.clock.AfterFunc(d, func() {
+			r.mu.Lock()
+			ok := g.inside && g.stay == stay
+			r.mu.Unlock()
+
+			if ok {
+				g.cb(ev)
+			}
+		})
+	}
+	return nil
+}
+
+// leave ends the stay of the pointer in g, returning the callback to run.
+func (g *region) leave(ev Event) func() {
+	if g.timer != nil {
+		g.timer.Stop()
+		g.timer = nil
+	}
+
+	if g.kind == regionLeave {
+		return func() { g.cb(ev) }
+	}
+	return nil
+}
+
+func pointIn(ev Event, rect image.Rectangle) bool {
+	return image.Pt(int(ev.X), int(ev.Y)).In(rect)
+}
+
+// clip returns where the segment from a to b is inside rect, as fractions
+// of the way from a to b (Liang-Barsky), or ok false if it never is. The
+// rectangle's pixels are taken to span [Min, Max-1] on each axis.
+func clip(a, b Event, rect image.Rectangle) (in, out float64, ok bool) {
+	if rect.Empty() {
+		return 0, 0, false
+	}
+
+	x0, y0 := float64(a.X), float64(a.Y)
+	dx, dy := float64(b.X)-x0, float64(b.Y)-y0
+	in, out = 0, 1
+
+	for _, v := range [][2]float64{
+		{-dx, x0 - float64(rect.Min.X)},
+		{dx, float64(rect.Max.X-1) - x0},
+		{-dy, y0 - float64(rect.Min.Y)},
+		{dy, float64(rect.Max.Y-1) - y0},
+	} {
+		p, q := v[0], v[1]
+		if p == 0 {
+			if q < 0 {
+				return 0, 0, false
+			}
+			continue
+		}
+
+		t := q / p
+		if p < 0 {
+			in = math.Max(in, t)
+		} else {
+			out = math.Min(out, t)
+		}
+	}
+
+	return in, out, in <= out
+}
+
+// lerp returns b moved back to the fraction t of the way from a to b.
+func lerp(a, b Event, t float64) Event {
+	e := b
+	e.X = int16(math.Round(float64(a.X) + t*(float64(b.X)-float64(a.X))))
+	e.Y = int16(math.Round(float64(a.Y) + t*(float64(b.Y)-float64(a.Y))))
+	if !a.When.IsZero() {
+		e.When = a.When.Add(time.Duration(t * float64(b.When.Sub(a.When))))
+	}
+	return e
+}
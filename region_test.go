@@ -0,0 +1,61 @@
+package hook
+
+import (
+	"image"
+	"testing"
+	"time"
+
+	"github.com/vcaesar/tt"
+)
+
+func TestRegions(t *testing.T) {
+	clock := &fakeClock{now: time.Unix(1e9, 0)}
+	r := NewRegions(RegionOptions{Screen: image.Rect(0, 0, 1920, 1080),
+		Clock: clock})
+
+	// The callbacks note where they fired.
+	rec := &recorder{}
+	hit := func(name string) func(Event) {
+		return func(e Event) {
+			rec.note(name + " " + image.Pt(int(e.X), int(e.Y)).String())
+		}
+	}
+	rect := image.Rect(10, 10, 20, 20)
+	r.OnEnterRect(rect, hit("enter"))
+	r.OnLeaveRect(rect, hit("leave"))
+	r.OnDwell(rect, 500*time.Millisecond, hit("dwell"))
+	r.HotCorner(BottomRight, 5, 0, hit("corner"))
+
+	move := func(x, y int16) []string {
+		return rec.run(func() {
+			r.Feed(Event{Kind: MouseMove, X: x, Y: y, When: clock.Now()})
+		})
+	}
+
+	tt.Equal(t, 0, len(move(0, 0)))
+	tt.Equal(t, []string{"enter (10,10)"}, move(15, 15))
+	tt.Equal(t, []string{"leave (19,19)"}, move(30, 30))
+
+	// A flick straight across the rectangle.
+	tt.Equal(t, 0, len(move(0, 15)))
+	tt.Equal(t, []string{"enter (10,15)", "leave (19,15)"}, move(40, 15))
+	// A segment passing beside it.
+	tt.Equal(t, 0, len(move(0, 25)))
+
+	tt.Equal(t, []string{"enter (10,14)"}, move(12, 12))
+	clock.Advance(499 * time.Millisecond)
+	tt.Equal(t, 0, len(move(13, 13)))
+	tt.Equal(t, []string{"dwell (10,14)"}, rec.run(func() {
+		clock.Advance(time.Millisecond)
+	}))
+
+	// Leaving before the dwell time cancels it.
+	tt.Equal(t, []string{"leave (19,19)"}, move(50, 50))
+	move(15, 15)
+	move(50, 50)
+	tt.Equal(t, 0, len(rec.run(func() { clock.Advance(time.Second) })))
+
+	tt.Equal(t, 0, len(move(1900, 1000)))
+	tt.Equal(t, []string{"corner (1918,1075)"}, move(1919, 1079))
+	tt.Equal(t, 0, len(move(1918, 1078)))
+}
@@ -0,0 +1,259 @@
+// Copyright 2016 The go-vgo Project Developers. See the COPYRIGHT
+// file at the top-level directory of this distribution and at
+// https://github.com/go-vgo/robotgo/blob/master/LICENSE
+//
+// Licensed under the Apache License, Version 2.0 <LICENSE-APACHE or
+// http://www.apache.org/licenses/LICENSE-2.0> or the MIT license
+// <LICENSE-MIT or http://opensource.org/licenses/MIT>, at your
+// option. This file may not be copied, modified, or distributed
+// except according to those terms.
+
+package hook
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+// seqNode is a node of the prefix tree of registered key sequences. The
+// root has no hotkey; each child is one more stroke.
+type seqNode struct {
+	hk   Hotkey
+	next []*seqNode
+	// seqs are the sequences through this node, done those ending at it.
+	seqs []*binding
+	done []*binding
+}
+
+// seqTree builds the prefix tree of the sequences bs.
+func seqTree(bs []*binding) *seqNode {
+	root := &seqNode{}
+	for _, b := range bs {
+		n := root
+		for _, hk := range b.seq {
+			i := slices.IndexFunc(n.next, func(c *seqNode) bool { return c.hk == hk })
+			if i < 0 {
+				n.next = append(n.next, &seqNode{hk: hk})
+				i = len(n.next) - 1
+			}
+			n = n.next[i]
+			n.seqs = append(n.seqs, b)
+		}
+		n.done = append(n.done, b)
+	}
+	return root
+}
+
+// match returns the child pressed by a key event for code.
+func (n *seqNode) match(code uint16, held Modifier) *seqNode {
+	for _, c := range n.next {
+		if c.hk.matches(code, held) {
+			return c
+		}
+	}
+	return nil
+}
+
+// seqState is the pending-prefix state of the sequences, owned by the
+// Process goroutine.
+type seqState struct {
+	root *seqNode // the tree node was found in
+	node *seqNode // nil when no prefix is pending
+	path []Hotkey
+	// live are the sequences through node whose strokes all came within
+	// their timeout.
+	live  []*binding
+	code  uint16    // the key of the last stroke
+	at    time.Time // and when it came
+	timer *time.Timer
+}
+
+// expired returns the channel that fires when the pending prefix times
+// out, or nil when there is none.
+func (s *seqState) expired() <-chan time.Time {
+	if s.timer == nil {
+		return nil
+	}
+	return s.timer.C
+}
+
+// reset drops the pending prefix.
+func (s *seqState) reset() {
+	if s.timer != nil {
+		s.timer.Stop()
+		s.timer = nil
+	}
+	s.root, s.node, s.path, s.live = nil, nil, nil, nil
+}
+
+// abort drops the pending prefix and reports it to the abort callback.
+func (s *seqState) abort(r *registry) {
+	path := s.path
+	s.reset()
+	if path != nil && r.onAbort != nil {
+		r.onAbort(path)
+	}
+}
+
+// feed advances the sequences by a KeyDown event, repeat if the key was
+// already down. It reports whether the event completed a sequence.
+func (s *seqState) feed(r *registry, ev Event, held Modifier, repeat bool) bool {
+	if s.node != nil && s.root != r.root {
+		// The sequences changed under the prefix.
+		s.abort(r)
+	}
+	if s.node != nil && repeat && ev.Keycode == s.code {
+		// Auto-repeat of the last stroke.
+		return false
+	}
+	now := time.Now()
+
+	var next *seqNode
+	var live []*binding
+	if s.node != nil {
+		if next = s.node.match(ev.Keycode, held); next != nil {
+			live = slices.DeleteFunc(slices.Clone(s.live), func(b *binding) bool {
+				return !slices.Contains(next.seqs, b) ||
+					b.timeout > 0 && now.Sub(s.at) > b.timeout
+			})
+		} else if modCodes[ev.Keycode] != 0 {
+			// A modifier pressed for the next stroke.
+			return false
+		}
+		if len(live) == 0 {
+			// A wrong or late stroke aborts the prefix, and may start
+			// another one.
+			s.abort(r)
+			next = nil
+		}
+	}
+	if next == nil {
+		if next = r.root.match(ev.Keycode, held); next == nil {
+			return false
+		}
+		live = next.seqs
+	}
+
+	var done []*binding
+	for _, b := range next.done {
+		if slices.Contains(live, b) {
+			done = append(done, b)
+		}
+	}
+	if len(done) > 0 {
+		s.reset()
+		for _, b := range done {
+			if !b.off.Load() {
+				b.run(ev)
+			}
+		}
+		return true
+	}
+
+	s.root, s.node, s.live = r.root, next, live
+	s.path = append(slices.Clip(s.path), next.hk)
+	s.code, s.at = ev.Keycode, now
+	if s.timer != nil {
+		s.timer.Stop()
+		s.timer = nil
+	}
+	if d := seqWait(live); d > 0 {
+		s.timer = time.NewTimer(d)
+	}
+
+	if r.onPrefix != nil {
+		r.onPrefix(s.path)
+	}
+	return false
+}
+
+// seqWait returns how long to wait for the next stroke of the sequences
+// bs: the longest of their timeouts, or 0 for no limit if one has none.
+func seqWait(bs []*binding) time.Duration {
+	var d time.Duration
+	for _, b := range bs {
+		if b.timeout <= 0 {
+			return 0
+		}
+		d = max(d, b.timeout)
+	}
+	return d
+}
+
+// ParseSequence parses space-separated accelerators, as in
+// "Ctrl+K Ctrl+C", see ParseHotkey.
+func ParseSequence(s string) ([]Hotkey, error) {
+	var seq []Hotkey
+	for _, f := range strings.Fields(s) {
+		hk, err := ParseHotkey(f)
+		if err != nil {
+			return nil, err
+		}
+		seq = append(seq, hk)
+	}
+
+	if len(seq) == 0 {
+		return nil, fmt.Errorf("%w %q", ErrInvalidHotkey, s)
+	}
+	return seq, nil
+}
+
+// RegisterSequence registers a key sequence on the default Hook, see
+// Hook.RegisterSequence.
+func RegisterSequence(seq []Hotkey, timeout time.Duration, cb func(Event)) (Binding, error) {
+	return std.RegisterSequence(seq, timeout, cb)
+}
+
+// RegisterSequence registers cb to run when the hotkeys in seq are pressed
+// one after the other, each within timeout of the previous one (no limit
+// if timeout is 0), as in Emacs' "Ctrl+X Ctrl+S". Each stroke matches its
+// modifiers exactly, and auto-repeat of a stroke is ignored. A sequence
+// that is a prefix of a longer one shadows it. cb receives the event of
+// the last stroke, which then runs no other binding.
+func (h *Hook) RegisterSequence(seq []Hotkey, timeout time.Duration, cb func(Event)) (Binding, error) {
+	if len(seq) == 0 {
+		return Binding{}, fmt.Errorf("%w: empty sequence", ErrInvalidHotkey)
+	}
+	for _, hk := range seq {
+		if _, ok := modAlias[hk.Key]; ok {
+			continue
+		}
+		if _, ok := Keycode[hk.Key]; !ok {
+			return Binding{}, fmt.Errorf("%w %q", ErrUnknownKey, hk.Key)
+		}
+	}
+
+	b := &binding{when: KeyDown, cb: cb, seq: slices.Clone(seq), timeout: timeout}
+	h.update(func(r *registry) {
+		r.seqs = append(slices.Clip(r.seqs), b)
+		r.root = seqTree(r.seqs)
+	})
+
+	return Binding{h: h, b: b}, nil
+}
+
+// OnSequencePrefix sets fn to run on the default Hook's pending prefixes,
+// see Hook.OnSequencePrefix.
+func OnSequencePrefix(fn func(pending []Hotkey)) {
+	std.OnSequencePrefix(fn)
+}
+
+// OnSequencePrefix sets fn to run whenever a stroke extends a registered
+// sequence without completing it, with the strokes pressed so far.
+func (h *Hook) OnSequencePrefix(fn func(pending []Hotkey)) {
+	h.update(func(r *registry) { r.onPrefix = fn })
+}
+
+// OnSequenceAbort sets fn to run when the default Hook abandons a prefix,
+// see Hook.OnSequenceAbort.
+func OnSequenceAbort(fn func(pending []Hotkey)) {
+	std.OnSequenceAbort(fn)
+}
+
+// OnSequenceAbort sets fn to run when a pending prefix is abandoned, because
+// the next stroke did not continue it or did not come in time.
+func (h *Hook) OnSequenceAbort(fn func(pending []Hotkey)) {
+	h.update(func(r *registry) { r.onAbort = fn })
+}
@@ -0,0 +1,149 @@
+package hook
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/vcaesar/tt"
+)
+
+func TestParseSequence(t *testing.T) {
+	seq, err := ParseSequence("Ctrl+K  ctrl+c")
+	tt.Nil(t, err)
+	tt.Equal(t, []Hotkey{{ModCtrl, "k"}, {ModCtrl, "c"}}, seq)
+
+	_, err = ParseSequence(" ")
+	tt.Equal(t, true, errors.Is(err, ErrInvalidHotkey))
+	_, err = ParseSequence("Ctrl+K Ctrl+Nope")
+	tt.Equal(t, true, errors.Is(err, ErrUnknownKey))
+}
+
+func TestSequence(t *testing.T) {
+	h := New(Options{})
+	var got []string
+	hit := func(name string) func(Event) {
+		return func(Event) { got = append(got, name) }
+	}
+
+	comment, _ := ParseSequence("Ctrl+K Ctrl+C")
+	_, err := h.RegisterSequence(comment, time.Minute, hit("comment"))
+	tt.Nil(t, err)
+	upper, _ := ParseSequence("Ctrl+K U")
+	b, err := h.RegisterSequence(upper, time.Minute, hit("upper"))
+	tt.Nil(t, err)
+	_, err = h.RegisterSequence(nil, 0, hit("none"))
+	tt.Equal(t, true, errors.Is(err, ErrInvalidHotkey))
+
+	h.OnSequencePrefix(func(p []Hotkey) { got = append(got, "prefix "+p[0].String()) })
+	h.OnSequenceAbort(func(p []Hotkey) { got = append(got, "abort "+p[0].String()) })
+
+	evs := make(chan Event)
+	out := h.Process(evs)
+	press := func(keys ...string) []string {
+		got = nil
+		for _, k := range keys {
+			code := Keycode[k]
+			if k == "/ctrl" {
+				evs <- Event{Kind: KeyUp, Keycode: Keycode["ctrl"]}
+				continue
+			}
+			if k, ok := strings.CutSuffix(k, "+"); ok {
+				// Held long enough to auto-repeat.
+				code = Keycode[k]
+				evs <- Event{Kind: KeyDown, Keycode: code}
+			}
+			evs <- Event{Kind: KeyDown, Keycode: code}
+			if modCodes[code] == 0 {
+				evs <- Event{Kind: KeyUp, Keycode: code}
+			}
+		}
+		evs <- Event{Kind: MouseMove}
+		return got
+	}
+
+	tt.Equal(t, []string{"prefix Ctrl+K", "comment"}, press("ctrl", "k", "c", "/ctrl"))
+	tt.Equal(t, []string{"prefix Ctrl+K", "upper"}, press("ctrl", "k", "/ctrl", "u"))
+	tt.Equal(t, []string{"prefix Ctrl+K", "abort Ctrl+K"}, press("ctrl", "k", "/ctrl", "x"))
+	// A wrong stroke may start a new prefix.
+	tt.Equal(t, []string{"prefix Ctrl+K", "abort Ctrl+K", "prefix Ctrl+K"},
+		press("ctrl", "k", "/ctrl", "ctrl", "q", "k", "/ctrl"))
+	tt.Equal(t, []string{"comment"}, press("ctrl", "c", "/ctrl"))
+
+	// Auto-repeat of the prefix key does not abort it.
+	tt.Equal(t, []string{"prefix Ctrl+K", "comment"}, press("ctrl", "k+", "c", "/ctrl"))
+
+	// The last stroke of a sequence runs no hotkey, unlike the same keys
+	// pressed on their own.
+	_, err = h.RegisterHotkey("Ctrl+C", hit("copy"))
+	tt.Nil(t, err)
+	tt.Equal(t, []string{"prefix Ctrl+K", "comment"}, press("ctrl", "k", "c", "/ctrl"))
+	tt.Equal(t, []string{"copy"}, press("ctrl", "c", "/ctrl"))
+
+	// Unregistering a sequence drops a prefix pending on it.
+	tt.Equal(t, []string{"prefix Ctrl+K"}, press("ctrl", "k", "/ctrl"))
+	b.Unregister()
+	tt.Equal(t, []string{"abort Ctrl+K"}, press("u"))
+	tt.Equal(t, []string{"prefix Ctrl+K", "abort Ctrl+K"}, press("ctrl", "k", "/ctrl", "u"))
+
+	close(evs)
+	<-out
+}
+
+func TestSequenceTimeout(t *testing.T) {
+	h := New(Options{})
+	aborted := make(chan []Hotkey, 1)
+	h.OnSequenceAbort(func(p []Hotkey) { aborted <- p })
+
+	seq, _ := ParseSequence("Ctrl+X Ctrl+S")
+	_, err := h.RegisterSequence(seq, 10*time.Millisecond, func(Event) {
+		t.Error("sequence fired after its timeout")
+	})
+	tt.Nil(t, err)
+
+	evs := make(chan Event)
+	out := h.Process(evs)
+	evs <- Event{Kind: KeyDown, Keycode: Keycode["ctrl"]}
+	evs <- Event{Kind: KeyDown, Keycode: Keycode["x"]}
+
+	tt.Equal(t, seq[:1], <-aborted)
+	evs <- Event{Kind: KeyDown, Keycode: Keycode["s"]}
+
+	close(evs)
+	<-out
+}
+
+func TestSequenceTimeouts(t *testing.T) {
+	h := New(Options{})
+	got := make(chan string, 2)
+	save, _ := ParseSequence("Ctrl+X Ctrl+S")
+	_, err := h.RegisterSequence(save, 10*time.Millisecond, func(Event) { got <- "save" })
+	tt.Nil(t, err)
+	// Sharing the prefix, with no limit.
+	find, _ := ParseSequence("Ctrl+X Ctrl+F")
+	_, err = h.RegisterSequence(find, 0, func(Event) { got <- "find" })
+	tt.Nil(t, err)
+
+	evs := make(chan Event)
+	out := h.Process(evs)
+	evs <- Event{Kind: KeyDown, Keycode: Keycode["ctrl"]}
+	evs <- Event{Kind: KeyDown, Keycode: Keycode["x"]}
+	evs <- Event{Kind: KeyUp, Keycode: Keycode["x"]}
+	time.Sleep(30 * time.Millisecond)
+	// Too late for Ctrl+X Ctrl+S, but Ctrl+X Ctrl+F still waits.
+	evs <- Event{Kind: KeyDown, Keycode: Keycode["s"]}
+	evs <- Event{Kind: KeyDown, Keycode: Keycode["x"]}
+	time.Sleep(30 * time.Millisecond)
+	evs <- Event{Kind: KeyDown, Keycode: Keycode["f"]}
+	select {
+	case name := <-got:
+		tt.Equal(t, "find", name)
+	case <-time.After(time.Second):
+		t.Error("Ctrl+X Ctrl+F inherited the timeout of Ctrl+X Ctrl+S")
+	}
+
+	close(evs)
+	<-out
+	tt.Equal(t, 0, len(got))
+}
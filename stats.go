@@ -0,0 +1,194 @@
+// Copyright 2016 The go-vgo Project Developers. See the COPYRIGHT
+// file at the top-level directory of this distribution and at
+// https://github.com/go-vgo/robotgo/blob/master/LICENSE
+//
+// Licensed under the Apache License, Version 2.0 <LICENSE-APACHE or
+// http://www.apache.org/licenses/LICENSE-2.0> or the MIT license
+// <LICENSE-MIT or http://opensource.org/licenses/MIT>, at your
+// option. This file may not be copied, modified, or distributed
+// except according to those terms.
+
+package hook
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// statsBuckets is the number of buckets a Stats window is split into.
+const statsBuckets = 60
+
+// StatsOptions configures a Stats collector.
+type StatsOptions struct {
+	// Window is the rolling window the counters cover, one minute if 0.
+	Window time.Duration
+	// Clock places the events in the window.
+	Clock Clock
+}
+
+// StatsSnapshot is the activity over a Stats window.
+type StatsSnapshot struct {
+	// Window is the span the counters cover: the Stats window, or the time
+	// since the first event if that is shorter.
+	Window time.Duration `json:"window_ns"`
+
+	Keystrokes    int     `json:"keystrokes"`
+	KeysPerMinute float64 `json:"keys_per_minute"`
+	// Clicks counts the MouseDown events by button name: "left", "right",
+	// "center", "back" and "forward".
+	Clicks map[string]int `json:"clicks"`
+	// WheelDistance is the wheel rotation, in notches in any direction.
+	WheelDistance int `json:"wheel_distance"`
+	// PointerTravel is the distance between consecutive pointer positions,
+	// in pixels.
+	PointerTravel float64 `json:"pointer_travel"`
+	// ActiveRatio is the fraction of the window's buckets (a sixtieth of
+	// the window each) with any input.
+	ActiveRatio float64 `json:"active_ratio"`
+}
+
+// statsButtons names the buttons counted by Stats, by Event.Button.
+var statsButtons = []string{1: "left", 2: "right", 3: "center", 4: "back", 5: "forward"}
+
+type statsBucket struct {
+	n      int64 // bucket number since the epoch; the bucket is stale if it differs
+	keys   int
+	clicks [6]int
+	wheel  int
+	travel float64
+	active bool
+}
+
+// Stats collects rolling-window input activity counters: keystrokes,
+// clicks per button, wheel distance, pointer travel and the active time
+// ratio. Snapshot reads the counters at any time.
+type Stats struct {
+	clock Clock
+	res   time.Duration // bucket length
+
+	mu      sync.Mutex
+	buckets [statsBuckets]statsBucket
+	first   int64 // bucket of the first event
+	started bool
+	last    Event // last pointer position
+	moved   bool
+}
+
+// NewStats returns an empty Stats collector.
+func NewStats(opts StatsOptions) *Stats {
+	if opts.Window <= 0 {
+		opts.Window = time.Minute
+	}
+
+	return &Stats{
+		clock: clockOr(opts.Clock),
+		res:   max(opts.Window/statsBuckets, 1),
+	}
+}
+
+// Process runs Feed on the events read from evChan, and signals out once
+// evChan is closed.
+func (s *Stats) Process(evChan <-chan Event) (out chan bool) {
+	return feedAll(evChan, s.Feed, nil)
+}
+
+// Feed counts one event.
+func (s *Stats) Feed(ev Event) {
+	at := ev.When
+	if at.IsZero() {
+		at = s.clock.Now()
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	b := s.bucket(at)
+	if b == nil {
+		return
+	}
+	switch ev.Kind {
+	case KeyDown:
+		b.keys++
+	case MouseDown:
+		if int(ev.Button) < len(b.clicks) {
+			b.clicks[ev.Button]++
+		}
+	case MouseWheel:
+		b.wheel += int(max(ev.Rotation, -ev.Rotation))
+	case MouseMove, MouseDrag:
+		if s.moved {
+			b.travel += math.Hypot(float64(ev.X)-float64(s.last.X),
+				float64(ev.Y)-float64(s.last.Y))
+		}
+		s.last, s.moved = ev, true
+	case KeyUp, KeyHold, MouseUp, MouseHold:
+		// Only counts as activity.
+	default:
+		return
+	}
+	b.active = true
+}
+
+// bucket returns the bucket for time at, clearing it if it is stale, or
+// nil if at is before the window or its bucket already holds a later time.
+func (s *Stats) bucket(at time.Time) *statsBucket {
+	n := at.UnixNano() / int64(s.res)
+	now := s.clock.Now().UnixNano() / int64(s.res)
+	if n <= now-statsBuckets {
+		return nil
+	}
+
+	b := &s.buckets[n%statsBuckets]
+	if b.n > n {
+		return nil
+	}
+	if b.n != n {
+		*b = statsBucket{n: n}
+	}
+	if !s.started {
+		s.first, s.started = n, true
+	}
+	return b
+}
+
+// Snapshot returns the counters over the window ending now.
+func (s *Stats) Snapshot() StatsSnapshot {
+	now := s.clock.Now().UnixNano() / int64(s.res)
+	snap := StatsSnapshot{Clicks: map[string]int{}}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	span := int64(statsBuckets)
+	if s.started {
+		span = min(span, now-s.first+1)
+	}
+	snap.Window = time.Duration(span) * s.res
+
+	active := 0
+	for i := range s.buckets {
+		b := &s.buckets[i]
+		if b.n <= now-span || b.n > now {
+			continue
+		}
+
+		snap.Keystrokes += b.keys
+		for btn, c := range b.clicks {
+			if c > 0 && btn < len(statsButtons) && statsButtons[btn] != "" {
+				snap.Clicks[statsButtons[btn]] += c
+			}
+		}
+		snap.WheelDistance += b.wheel
+		snap.PointerTravel += b.travel
+		if b.active {
+			active++
+		}
+	}
+
+	if span > 0 {
+		snap.KeysPerMinute = float64(snap.Keystrokes) / snap.Window.Minutes()
+		snap.ActiveRatio = float64(active) / float64(span)
+	}
+	return snap
+}
@@ -0,0 +1,62 @@
+package hook
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/vcaesar/tt"
+)
+
+func TestStats(t *testing.T) {
+	clock := &fakeClock{now: time.Unix(1e9, 0)}
+	s := NewStats(StatsOptions{Clock: clock})
+	feed := func(e Event) {
+		e.When = clock.Now()
+		s.Feed(e)
+	}
+
+	for i := 0; i < 30; i++ {
+		feed(Event{Kind: KeyDown})
+		feed(Event{Kind: KeyUp})
+	}
+	feed(Event{Kind: MouseDown, Button: MouseMap["left"]})
+	feed(Event{Kind: MouseDown, Button: MouseMap["right"]})
+	feed(Event{Kind: MouseDown, Button: MouseMap["left"]})
+	feed(Event{Kind: MouseWheel, Rotation: WheelUp})
+	feed(Event{Kind: MouseWheel, Rotation: 2 * WheelDown})
+	feed(Event{Kind: MouseMove, X: 0, Y: 0})
+	clock.Advance(30 * time.Second)
+	feed(Event{Kind: MouseMove, X: 3, Y: 4})
+	feed(Event{Kind: MouseDrag, X: 3, Y: 14})
+	clock.Advance(29 * time.Second)
+
+	snap := s.Snapshot()
+	tt.Equal(t, time.Minute, snap.Window)
+	tt.Equal(t, 30, snap.Keystrokes)
+	tt.Equal(t, 30.0, snap.KeysPerMinute)
+	tt.Equal(t, map[string]int{"left": 2, "right": 1}, snap.Clicks)
+	tt.Equal(t, 3, snap.WheelDistance)
+	tt.Equal(t, 15.0, snap.PointerTravel)
+	tt.Equal(t, 2.0/60, snap.ActiveRatio)
+
+	js, err := json.Marshal(snap)
+	tt.Nil(t, err)
+	var back StatsSnapshot
+	tt.Nil(t, json.Unmarshal(js, &back))
+	tt.Equal(t, snap, back)
+
+	// The first second drops out of the window.
+	clock.Advance(time.Second)
+	snap = s.Snapshot()
+	tt.Equal(t, 0, snap.Keystrokes)
+	tt.Equal(t, 15.0, snap.PointerTravel)
+	tt.Equal(t, 1.0/60, snap.ActiveRatio)
+
+	// An event from before the window is ignored, rather than wiping the
+	// newer bucket in its slot.
+	s.Feed(Event{Kind: KeyDown, When: clock.Now().Add(-90 * time.Second)})
+	snap = s.Snapshot()
+	tt.Equal(t, 0, snap.Keystrokes)
+	tt.Equal(t, 15.0, snap.PointerTravel)
+}
@@ -0,0 +1,154 @@
+// Copyright 2016 The go-vgo Project Developers. See the COPYRIGHT
+// file at the top-level directory of this distribution and at
+// https://github.com/go-vgo/robotgo/blob/master/LICENSE
+//
+// Licensed under the Apache License, Version 2.0 <LICENSE-APACHE or
+// http://www.apache.org/licenses/LICENSE-2.0> or the MIT license
+// <LICENSE-MIT or http://opensource.org/licenses/MIT>, at your
+// option. This file may not be copied, modified, or distributed
+// except according to those terms.
+
+package hook
+
+import (
+	"sync"
+	"unicode"
+)
+
+// TextStream reconstructs the text the user types from the event stream
+// and reports it in runs. A run is committed when it is broken by Enter,
+// Tab, Escape or any other key that types no character (arrows, Home,
+// function keys), by a chord with Ctrl, Alt or Meta, by a mouse click, or
+// when the hook stops. Backspace removes the last character of the current
+// run; once a run is committed it is not edited any more.
+//
+// Backends report typed characters in two ways: libuiohook and the Windows
+// purego backend send a separate typed event (KeyHold with no Keycode)
+// after each KeyDown, also on auto-repeat, while the other backends put the
+// Keychar on the KeyDown itself and send auto-repeat as KeyHold. TextStream
+// accepts both.
+//
+// The OnRun callback runs on the goroutine calling Feed or Flush.
+type TextStream struct {
+	onRun func(run string)
+
+	mu      sync.Mutex
+	run     []rune
+	mods    map[uint16]bool // modifier keys held
+	pending bool            // a key was pressed whose character is not known yet
+	chord   bool            // the last key press was a chord
+}
+
+// TextOptions configures a TextStream.
+type TextOptions struct {
+	// OnRun receives each committed run.
+	OnRun func(run string)
+}
+
+// NewTextStream returns a TextStream with an empty run.
+func NewTextStream(opts TextOptions) *TextStream {
+	return &TextStream{onRun: opts.OnRun, mods: map[uint16]bool{}}
+}
+
+// Process runs Feed on the events read from evChan, commits the last run
+// once evChan is closed and then signals out.
+func (t *TextStream) Process(evChan <-chan Event) (out chan bool) {
+	return feedAll(evChan, t.Feed, t.Flush)
+}
+
+// Pending returns the current, uncommitted run.
+func (t *TextStream) Pending() string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return string(t.run)
+}
+
+// Flush commits the current run.
+func (t *TextStream) Flush() {
+	t.mu.Lock()
+	run := t.commit()
+	t.mu.Unlock()
+	t.emit(run)
+}
+
+// Feed passes one event to the stream.
+func (t *TextStream) Feed(ev Event) {
+	t.mu.Lock()
+	var runs []string
+	typed := ev.Kind == KeyHold && ev.Keycode == 0
+	if t.pending && !typed {
+		// The last key typed nothing: it moved the caret or focus.
+		runs = append(runs, t.commit())
+	}
+	t.pending = false
+
+	switch ev.Kind {
+	case KeyDown, KeyHold:
+		runs = append(runs, t.key(ev, typed))
+	case KeyUp:
+		delete(t.mods, ev.Keycode)
+	case MouseDown, HookDisabled:
+		runs = append(runs, t.commit())
+	}
+	t.mu.Unlock()
+
+	for _, run := range runs {
+		t.emit(run)
+	}
+}
+
+// key handles a key press or typed character, returning a committed run.
+func (t *TextStream) key(ev Event, typed bool) string {
+	if modCodes[ev.Keycode] != 0 {
+		t.mods[ev.Keycode] = true
+		return ""
+	}
+
+	if typed {
+		// The character of the key just pressed.
+		if t.chord || ev.Keychar == '\b' {
+			return ""
+		}
+		return t.char(ev.Keychar)
+	}
+
+	// AltGr is right Alt, which Windows also reports with Ctrl.
+	held := heldMods(t.mods, ev.Mask)
+	t.chord = held&(ModCtrl|ModLAlt|ModCmd) != 0 && held&ModRAlt == 0
+	switch {
+	case t.chord:
+		return t.commit()
+	case ev.Keycode == Keycode["delete"]: // Backspace
+		if len(t.run) > 0 {
+			t.run = t.run[:len(t.run)-1]
+		}
+		return ""
+	case ev.Keychar == CharUndefined:
+		t.pending = true
+		return ""
+	}
+	return t.char(ev.Keychar)
+}
+
+// char adds a typed character to the run, or commits the run for a control
+// character such as Enter or Tab.
+func (t *TextStream) char(r rune) string {
+	if !unicode.IsPrint(r) {
+		return t.commit()
+	}
+	t.run = append(t.run, r)
+	return ""
+}
+
+// commit ends the current run and returns it.
+func (t *TextStream) commit() string {
+	run := string(t.run)
+	t.run = t.run[:0]
+	return run
+}
+
+func (t *TextStream) emit(run string) {
+	if run != "" && t.onRun != nil {
+		t.onRun(run)
+	}
+}
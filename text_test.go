@@ -0,0 +1,129 @@
+package hook
+
+import (
+	"testing"
+
+	"github.com/vcaesar/tt"
+)
+
+// textRuns feeds evs to a new TextStream and returns the committed runs and
+// the pending one.
+func textRuns(evs ...Event) ([]string, string) {
+	rec := &recorder{}
+	t := NewTextStream(TextOptions{OnRun: rec.note})
+	for _, ev := range evs {
+		t.Feed(ev)
+	}
+	return rec.got, t.Pending()
+}
+
+// typeChars returns the events of a backend that puts the Keychar on KeyDown.
+func typeChars(s string) (evs []Event) {
+	for _, r := range s {
+		evs = append(evs,
+			Event{Kind: KeyDown, Keycode: Keycode["a"], Keychar: r},
+			Event{Kind: KeyUp, Keycode: Keycode["a"], Keychar: r})
+	}
+	return
+}
+
+// typeTyped returns the events of a backend that sends typed events.
+func typeTyped(s string) (evs []Event) {
+	for _, r := range s {
+		evs = append(evs,
+			Event{Kind: KeyDown, Keycode: Keycode["a"], Keychar: CharUndefined},
+			Event{Kind: KeyHold, Keychar: r},
+			Event{Kind: KeyUp, Keycode: Keycode["a"], Keychar: CharUndefined})
+	}
+	return
+}
+
+func textKey(kind uint8, name string) Event {
+	return Event{Kind: kind, Keycode: Keycode[name], Keychar: CharUndefined}
+}
+
+func TestTextStream(t *testing.T) {
+	for _, typ := range []func(string) []Event{typeChars, typeTyped} {
+		evs := typ("helo")
+		evs = append(evs, textKey(KeyDown, "delete"), textKey(KeyUp, "delete"))
+		evs = append(evs, typ("lo")...)
+		evs = append(evs, textKey(KeyDown, "enter"), textKey(KeyUp, "enter"))
+		evs = append(evs, typ("wörld")...)
+
+		runs, pending := textRuns(evs...)
+		tt.Equal(t, []string{"hello"}, runs)
+		tt.Equal(t, "wörld", pending)
+	}
+}
+
+func TestTextStreamBreaks(t *testing.T) {
+	evs := typeChars("ab")
+	evs = append(evs, textKey(KeyDown, "left"), textKey(KeyUp, "left"))
+	evs = append(evs, typeChars("cd")...)
+	evs = append(evs, Event{Kind: MouseDown, Button: 1})
+	evs = append(evs, typeTyped("ef")...)
+	// Enter through a typed '\r'.
+	evs = append(evs, textKey(KeyDown, "enter"), Event{Kind: KeyHold, Keychar: '\r'})
+	evs = append(evs, typeTyped("g")...)
+	evs = append(evs, Event{Kind: HookDisabled})
+
+	runs, pending := textRuns(evs...)
+	tt.Equal(t, []string{"ab", "cd", "ef", "g"}, runs)
+	tt.Equal(t, "", pending)
+}
+
+func TestTextStreamChords(t *testing.T) {
+	evs := typeTyped("ab")
+	evs = append(evs, textKey(KeyDown, "ctrl"),
+		Event{Kind: KeyDown, Keycode: Keycode["c"], Keychar: CharUndefined},
+		Event{Kind: KeyHold, Keychar: 3},
+		textKey(KeyUp, "c"), textKey(KeyUp, "ctrl"))
+	// Shift and AltGr still type.
+	evs = append(evs, textKey(KeyDown, "shift"),
+		Event{Kind: KeyDown, Keycode: Keycode["c"], Keychar: 'C', Mask: maskShiftL},
+		textKey(KeyUp, "shift"))
+	evs = append(evs, Event{Kind: KeyDown, Keycode: Keycode["q"],
+		Keychar: '@', Mask: maskCtrlL | maskAltR})
+	// Alt chords carry the modifier in the mask only.
+	evs = append(evs, Event{Kind: KeyDown, Keycode: Keycode["tab"],
+		Keychar: '\t', Mask: maskAltL})
+
+	runs, pending := textRuns(evs...)
+	tt.Equal(t, []string{"ab", "C@"}, runs)
+	tt.Equal(t, "", pending)
+}
+
+func TestTextStreamRepeat(t *testing.T) {
+	// Auto-repeat as KeyHold with the Keychar.
+	evs := []Event{
+		{Kind: KeyDown, Keycode: Keycode["x"], Keychar: 'x'},
+		{Kind: KeyHold, Keycode: Keycode["x"], Keychar: 'x'},
+		{Kind: KeyHold, Keycode: Keycode["x"], Keychar: 'x'},
+		{Kind: KeyUp, Keycode: Keycode["x"], Keychar: 'x'},
+		{Kind: KeyHold, Keycode: Keycode["delete"], Keychar: CharUndefined},
+	}
+	_, pending := textRuns(evs...)
+	tt.Equal(t, "xx", pending)
+
+	// Auto-repeat as repeated KeyDown and typed events.
+	evs = append(typeTyped("y"), typeTyped("y")[:2]...)
+	evs = append(evs, typeTyped("y")[:2]...)
+	evs = append(evs, textKey(KeyDown, "delete"), Event{Kind: KeyHold, Keychar: '\b'},
+		textKey(KeyDown, "delete"), Event{Kind: KeyHold, Keychar: '\b'})
+	_, pending = textRuns(evs...)
+	tt.Equal(t, "y", pending)
+}
+
+func TestTextStreamProcess(t *testing.T) {
+	rec := &recorder{}
+	ts := NewTextStream(TextOptions{OnRun: rec.note})
+
+	ch := make(chan Event)
+	out := ts.Process(ch)
+	for _, ev := range typeChars("hi") {
+		ch <- ev
+	}
+	close(ch)
+	<-out
+	tt.Equal(t, []string{"hi"}, rec.got)
+}
@@ -41,7 +41,6 @@
 package hook
 
 import (
-	"time"
 	"unicode/utf8"
 
 	"github.com/vcaesar/go-wayland/client"
@@ -63,14 +62,8 @@ const (
 	axisHorizontalScroll = 1
 )
 
-// libuiohook-compatible scroll direction constants (matches the C backend).
-const (
-	wheelVertical   = 3
-	wheelHorizontal = 4
-)
-
 // waylandState holds the live connection objects for the running session so
-// End() can tear them down. Guarded by the package-level lck mutex.
+// stopBackend() can tear them down. Guarded by the package-level lck mutex.
 type waylandState struct {
 	display  *client.Display
 	seat     *client.Seat
@@ -79,37 +72,35 @@ type waylandState struct {
 
 	// last known pointer position within the focused surface.
 	x, y int16
+
+	// caps are the seat capabilities, used by the dispatch goroutine only.
+	// rebind asks it to bind the devices a widened subscription needs.
+	caps   uint32
+	rebind chan struct{}
 }
 
 var wl *waylandState
 
-// Start adds the Wayland input listener and returns the event channel.
+// backendName names this backend in Snapshot.
+const backendName = "wayland"
+
+// osTime maps the times of the wl_keyboard and wl_pointer events, in
+// milliseconds.
+var osTime = newOSClock(1e6, 1, true)
+
+// runBackend runs the Wayland input listener until stopBackend is called.
 //
 // The optional timeout argument is accepted for API parity with the CGo
 // backend but is ignored: the Wayland backend is event-driven (it blocks on
 // the compositor socket) rather than polled.
-func Start(tm ...int) chan Event {
+func runBackend(tm ...int) {
 	_ = tm
 
-	ev = make(chan Event, 1024)
-	asyncon = true
-
-	go waylandLoop()
-
-	return ev
+	waylandLoop()
 }
 
-// End removes the Wayland input listener and resets all hook state. The
-// optional timeout is the grace period (ms) to let the dispatch loop drain
-// before the channel closes (API parity with the other backends).
-func End(tm ...int) {
-	tm1 := 10
-	if len(tm) > 0 {
-		tm1 = tm[0]
-	}
-
-	asyncon = false
-
+// stopBackend removes the Wayland input listener.
+func stopBackend() {
 	lck.Lock()
 	st := wl
 	wl = nil
@@ -124,15 +115,24 @@ func End(tm ...int) {
 			}
 		}
 	}
+}
 
-	time.Sleep(time.Millisecond * time.Duration(tm1))
+// subscribe asks the dispatch loop to bind the devices kinds need. The
+// Context is not safe for concurrent use, so it binds them itself.
+func subscribe(kinds kindSet) error {
+	_ = kinds
 
-	for len(ev) != 0 {
-		<-ev
-	}
-	close(ev)
+	lck.Lock()
+	st := wl
+	lck.Unlock()
 
-	resetState()
+	if st != nil {
+		select {
+		case st.rebind <- struct{}{}:
+		default:
+		}
+	}
+	return nil
 }
 
 // addEvent: the single-shot *blocking* listener (AddEvent/StopEvent) is a
@@ -148,24 +148,36 @@ func addEvent(key string) int {
 // StopEvent is a no-op on the Wayland backend (see addEvent).
 func StopEvent() {}
 
+// postEvent: Wayland gives clients no way to post input to other surfaces.
+func postEvent(ev Event) error {
+	_ = ev
+	return ErrNotSupported
+}
+
+// grabHotkey: Wayland gives clients no global key grabs.
+func grabHotkey(hk Hotkey) (release func(), err error) {
+	_ = hk
+	return nil, ErrNotSupported
+}
+
 // waylandLoop connects to the compositor, wires up seat input handlers and
-// pumps the dispatch loop until End() closes the connection.
+// pumps the dispatch loop until stopBackend() closes the connection.
 func waylandLoop() {
 	display, err := client.Connect("")
 	if err != nil {
 		// No compositor / not a Wayland session: report disabled and bail.
-		send(Event{Kind: HookDisabled})
+		fail(wrapErr(ErrNoDisplay, err))
 		return
 	}
 
 	registry, err := display.GetRegistry()
 	if err != nil {
-		send(Event{Kind: HookDisabled})
 		_ = display.Context().Close()
+		fail(wrapErr(ErrBackend, err))
 		return
 	}
 
-	st := &waylandState{display: display}
+	st := &waylandState{display: display, rebind: make(chan struct{}, 1)}
 	lck.Lock()
 	wl = st
 	lck.Unlock()
@@ -185,6 +197,7 @@ func waylandLoop() {
 		lck.Unlock()
 
 		seat.SetCapabilitiesHandler(func(ce client.SeatCapabilitiesEvent) {
+			st.caps = ce.Capabilities
 			bindSeatCapabilities(st, seat, ce.Capabilities)
 		})
 	})
@@ -192,28 +205,63 @@ func waylandLoop() {
 	// First roundtrip surfaces the globals (and binds the seat); the second
 	// delivers the seat capabilities so keyboard/pointer get created.
 	if err := display.Roundtrip(); err != nil {
-		send(Event{Kind: HookDisabled})
+		fail(wrapErr(ErrBackend, err))
 		return
 	}
 	if err := display.Roundtrip(); err != nil {
-		send(Event{Kind: HookDisabled})
+		fail(wrapErr(ErrBackend, err))
+		return
+	}
+
+	lck.Lock()
+	seat := st.seat
+	lck.Unlock()
+	if seat == nil {
+		_ = display.Context().Close()
+		fail(ErrNoSeat)
 		return
 	}
 
 	send(Event{Kind: HookEnabled})
 
-	for asyncon {
-		if err := display.Context().Dispatch(); err != nil {
-			// Closed by End() or the compositor went away.
-			break
+	// Read the socket on another goroutine and dispatch here, so the loop
+	// can also bind devices for subscribe.
+	msgs := make(chan func() error)
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		for {
+			select {
+			case msgs <- display.Context().GetDispatch():
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	for asyncon.Load() {
+		select {
+		case dispatch := <-msgs:
+			if err := dispatch(); err != nil {
+				// Closed by stopBackend() or the compositor went away.
+				if asyncon.Load() {
+					fail(wrapErr(ErrNoDisplay, err))
+				}
+				return
+			}
+		case <-st.rebind:
+			bindSeatCapabilities(st, seat, st.caps)
 		}
 	}
 }
 
 // bindSeatCapabilities lazily creates the keyboard/pointer objects advertised
-// by the seat and attaches the gohook event translators.
+// by the seat and attaches the gohook event translators. It skips a device
+// whose kinds no running Hook wants.
 func bindSeatCapabilities(st *waylandState, seat *client.Seat, caps uint32) {
-	if caps&uint32(client.SeatCapabilityKeyboard) != 0 {
+	kinds := kindSet(wanted.Load())
+
+	if caps&uint32(client.SeatCapabilityKeyboard) != 0 && kinds&keyKinds != 0 {
 		lck.Lock()
 		need := st.keyboard == nil
 		lck.Unlock()
@@ -227,7 +275,8 @@ func bindSeatCapabilities(st *waylandState, seat *client.Seat, caps uint32) {
 		}
 	}
 
-	if caps&uint32(client.SeatCapabilityPointer) != 0 {
+	if caps&uint32(client.SeatCapabilityPointer) != 0 &&
+		kinds&(buttonKinds|motionKinds) != 0 {
 		lck.Lock()
 		need := st.pointer == nil
 		lck.Unlock()
@@ -254,7 +303,9 @@ func attachKeyboard(kb *client.Keyboard) {
 		default: // KeyboardKeyStatePressed
 			kind = KeyDown
 		}
-		send(keyEvent(kind, e.Key))
+		ev := keyEvent(kind, e.Key)
+		ev.OSTime = uint64(e.Time)
+		send(ev)
 	})
 }
 
@@ -267,7 +318,7 @@ func attachPointer(st *waylandState, p *client.Pointer) {
 		x, y := st.x, st.y
 		lck.Unlock()
 
-		send(Event{Kind: MouseMove, X: x, Y: y})
+		send(Event{Kind: MouseMove, X: x, Y: y, OSTime: uint64(e.Time)})
 	})
 
 	p.SetButtonHandler(func(e client.PointerButtonEvent) {
@@ -282,6 +333,7 @@ func attachPointer(st *waylandState, p *client.Pointer) {
 
 		send(Event{
 			Kind:   uint8(kind),
+			OSTime: uint64(e.Time),
 			Button: mouseButton(e.Button),
 			Clicks: 1,
 			X:      x,
@@ -294,7 +346,7 @@ func attachPointer(st *waylandState, p *client.Pointer) {
 		x, y := st.x, st.y
 		lck.Unlock()
 
-		dir := uint8(wheelVertical)
+		dir := wheelVertical
 		if e.Axis == axisHorizontalScroll {
 			dir = wheelHorizontal
 		}
@@ -307,6 +359,7 @@ func attachPointer(st *waylandState, p *client.Pointer) {
 
 		send(Event{
 			Kind:      MouseWheel,
+			OSTime:    uint64(e.Time),
 			X:         x,
 			Y:         y,
 			Amount:    uint16(amt),
@@ -335,9 +388,12 @@ func keyEvent(kind uint8, evcode uint32) Event {
 		return e
 	}
 
-	if kc, ok := Keycode[name]; ok {
+	switch kc, ok := Keycode[name]; {
+	case ok:
 		e.Keycode = kc
-	} else {
+	case name == "ctrlr": // Keycode has no right Ctrl
+		e.Keycode = vcCtrlR
+	default:
 		e.Keycode = uint16(evcode)
 	}
 
@@ -373,24 +429,6 @@ func mouseButton(code uint32) uint16 {
 	}
 }
 
-// send timestamps and pushes an event onto the global channel. It drops the
-// event (rather than blocking the compositor dispatch loop) if no consumer is
-// keeping up and the buffer is full. The recover guards the small shutdown
-// window where End() may have closed ev while a handler is still in flight.
-func send(e Event) {
-	if !asyncon {
-		return
-	}
-	defer func() { _ = recover() }() // ev closed by End(): drop silently
-
-	e.When = time.Now()
-	select {
-	case ev <- e:
-	default:
-		// channel full: drop to avoid stalling the Wayland event loop.
-	}
-}
-
 // waylandKeyName maps Linux evdev keycodes (linux/input-event-codes.h) to the
 // gohook/vcaesar key-name strings. Keep this in sync with vcaesar/keycode so
 // Keycode[name] resolves for hotkey matching via Register().
@@ -481,7 +519,7 @@ var waylandKeyName = map[uint32]string{
 	87: "f11",
 	88: "f12",
 	96: "num_enter",
-	97: "ctrl", // KEY_RIGHTCTRL
+	97: "ctrlr", // KEY_RIGHTCTRL
 	98: "num_slash",
 
 	100: "altr", // KEY_RIGHTALT
@@ -32,13 +32,12 @@
 // │  A WH_*_LL hook is dispatched through the message queue of the thread    │
 // │  that installed it, so that thread MUST install the hook and pump a      │
 // │  GetMessage loop. winLoop() therefore pins itself with LockOSThread and  │
-// │  End() tears the loop down by posting WM_QUIT to it.                     │
+// │  stopBackend() tears the loop down by posting WM_QUIT to it.             │
 // └───────────────────────────────────────────────────────────────────────────┘
 package hook
 
 import (
 	"runtime"
-	"time"
 	"unsafe"
 
 	"golang.org/x/sys/windows"
@@ -72,9 +71,11 @@ const (
 	wmMouseHWheel = 0x020E
 )
 
-// KBDLLHOOKSTRUCT flag bits and misc constants.
+// KBDLLHOOKSTRUCT and MSLLHOOKSTRUCT flag bits and misc constants.
 const (
 	llkhfExtended = 0x01
+	llkhfInjected = 0x10
+	llmhfInjected = 0x01
 	wheelDelta    = 120
 	xbutton1      = 0x0001
 	xbutton2      = 0x0002
@@ -98,42 +99,6 @@ const (
 	vkScroll   = 0x91
 )
 
-// libuiohook modifier mask bits (iohook.h). Tracked so Event.Mask matches the
-// CGo backend.
-const (
-	maskShiftL = 1 << 0
-	maskCtrlL  = 1 << 1
-	maskMetaL  = 1 << 2
-	maskAltL   = 1 << 3
-	maskShiftR = 1 << 4
-	maskCtrlR  = 1 << 5
-	maskMetaR  = 1 << 6
-	maskAltR   = 1 << 7
-
-	maskButton1 = 1 << 8
-	maskButton2 = 1 << 9
-	maskButton3 = 1 << 10
-	maskButton4 = 1 << 11
-	maskButton5 = 1 << 12
-
-	maskNumLock    = 1 << 13
-	maskCapsLock   = 1 << 14
-	maskScrollLock = 1 << 15
-
-	maskShift = maskShiftL | maskShiftR
-	maskCtrl  = maskCtrlL | maskCtrlR
-	maskMeta  = maskMetaL | maskMetaR
-	maskAlt   = maskAltL | maskAltR
-
-	maskButtons = maskButton1 | maskButton2 | maskButton3 | maskButton4 | maskButton5
-)
-
-// Mouse wheel scroll directions (iohook.h).
-const (
-	wheelVerticalDir   = 3
-	wheelHorizontalDir = 4
-)
-
 // POINT mirrors the Win32 POINT struct.
 type point struct {
 	x, y int32
@@ -186,7 +151,7 @@ var (
 	procGetCurrentThread = kernel32.NewProc("GetCurrentThreadId")
 )
 
-// winState holds the live hook session so End() can tear it down. Guarded by
+// winState holds the live hook session so stopBackend() can tear it down. Guarded by
 // the package-level lck mutex.
 type winState struct {
 	keyboardHook uintptr
@@ -215,31 +180,24 @@ var (
 	lastMoveY   int32
 )
 
-// Start installs the Win32 low-level keyboard/mouse hooks and returns the
-// event channel. The optional timeout argument is accepted for API parity with
-// the CGo backend but ignored: this backend is event-driven (it blocks in a
-// GetMessage loop) rather than polled.
-func Start(tm ...int) chan Event {
-	_ = tm
+// backendName names this backend in Snapshot.
+const backendName = "windows"
 
-	ev = make(chan Event, 1024)
-	asyncon = true
+// osTime maps the hook structs' tick count times, in milliseconds.
+var osTime = newOSClock(1e6, 1, true)
 
-	go winLoop()
+// runBackend runs the Win32 low-level keyboard/mouse hooks until
+// stopBackend is called. The optional timeout argument is accepted for API
+// parity with the CGo backend but ignored: this backend is event-driven (it
+// blocks in a GetMessage loop) rather than polled.
+func runBackend(tm ...int) {
+	_ = tm
 
-	return ev
+	winLoop()
 }
 
-// End removes the hooks and resets all hook state. The optional timeout is the
-// grace period (ms) to let the message loop drain before the channel closes.
-func End(tm ...int) {
-	tm1 := 10
-	if len(tm) > 0 {
-		tm1 = tm[0]
-	}
-
-	asyncon = false
-
+// stopBackend removes the hooks.
+func stopBackend() {
 	lck.Lock()
 	tid := uint32(0)
 	if win != nil {
@@ -252,15 +210,13 @@ func End(tm ...int) {
 	if tid != 0 {
 		procPostThreadMessage.Call(uintptr(tid), wmQuit, 0, 0)
 	}
+}
 
-	time.Sleep(time.Millisecond * time.Duration(tm1))
-
-	for len(ev) != 0 {
-		<-ev
-	}
-	close(ev)
-
-	resetState()
+// subscribe: the low-level hooks see every event; send drops the kinds
+// nobody wants.
+func subscribe(kinds kindSet) error {
+	_ = kinds
+	return nil
 }
 
 // addEvent: the single-shot *blocking* listener (AddEvent/StopEvent) is a
@@ -276,8 +232,21 @@ func addEvent(key string) int {
 // StopEvent is a no-op on the pure-Go Windows backend (see addEvent).
 func StopEvent() {}
 
+// postEvent: posting synthetic events is not implemented on the pure-Go
+// Windows backend.
+func postEvent(ev Event) error {
+	_ = ev
+	return ErrNotSupported
+}
+
+// grabHotkey: grabs are implemented on the pure-Go X11 backend only.
+func grabHotkey(hk Hotkey) (release func(), err error) {
+	_ = hk
+	return nil, ErrNotSupported
+}
+
 // winLoop installs the hooks on a pinned OS thread and pumps the message loop
-// until End() posts WM_QUIT.
+// until stopBackend() posts WM_QUIT.
 func winLoop() {
 	// LL hooks are delivered on the installing thread's message queue, so this
 	// goroutine must stay on one OS thread for the whole session.
@@ -301,7 +270,7 @@ func winLoop() {
 		if msHook != 0 {
 			procUnhookWindowsHook.Call(msHook)
 		}
-		send(Event{Kind: HookDisabled})
+		fail(ErrHookInstall)
 		return
 	}
 
@@ -316,9 +285,9 @@ func winLoop() {
 	send(Event{Kind: HookEnabled})
 
 	// Windows has no native "hook start" callback; the loop blocks here until
-	// WM_QUIT (posted by End()) or an error.
+	// WM_QUIT (posted by stopBackend()) or an error.
 	var m msg
-	for asyncon {
+	for asyncon.Load() {
 		ret, _, _ := procGetMessage.Call(uintptr(unsafe.Pointer(&m)), 0, 0, 0)
 		if int32(ret) <= 0 { // 0 == WM_QUIT, -1 == error
 			break
@@ -354,8 +323,9 @@ func processKeyPressed(kb *kbdLLHookStruct) {
 	setKeyModifier(kb.vkCode, true)
 
 	vk := uint16(kb.vkCode)
-	send(Event{
+	sendFrom(kb.flags&llkhfInjected != 0, Event{
 		Kind:    KeyDown,
+		OSTime:  uint64(kb.time),
 		Mask:    winModifiers,
 		Keycode: vkToKeycode(vk, kb.flags),
 		Rawcode: vk,
@@ -369,8 +339,9 @@ func processKeyPressed(kb *kbdLLHookStruct) {
 		raw2keyWin[vk] = string([]rune{r})
 		lck.Unlock()
 
-		send(Event{
+		sendFrom(kb.flags&llkhfInjected != 0, Event{
 			Kind:    KeyHold,
+			OSTime:  uint64(kb.time),
 			Mask:    winModifiers,
 			Keycode: 0, // VC_UNDEFINED, as in the CGo backend
 			Rawcode: vk,
@@ -383,8 +354,9 @@ func processKeyReleased(kb *kbdLLHookStruct) {
 	setKeyModifier(kb.vkCode, false)
 
 	vk := uint16(kb.vkCode)
-	send(Event{
+	sendFrom(kb.flags&llkhfInjected != 0, Event{
 		Kind:    KeyUp,
+		OSTime:  uint64(kb.time),
 		Mask:    winModifiers,
 		Keycode: vkToKeycode(vk, kb.flags),
 		Rawcode: vk,
@@ -421,9 +393,9 @@ func mouseProc(nCode int, wParam uintptr, ms *msLLHookStruct) uintptr {
 		case wmMouseMove:
 			processMouseMoved(ms)
 		case wmMouseWheel:
-			processMouseWheel(ms, wheelVerticalDir)
+			processMouseWheel(ms, wheelVertical)
 		case wmMouseHWheel:
-			processMouseWheel(ms, wheelHorizontalDir)
+			processMouseWheel(ms, wheelHorizontal)
 		}
 	}
 
@@ -466,8 +438,9 @@ func processButtonPressed(ms *msLLHookStruct, button uint16) {
 	clickTime = ms.time
 	lastClickX, lastClickY = ms.pt.x, ms.pt.y
 
-	send(Event{
+	sendFrom(ms.flags&llmhfInjected != 0, Event{
 		Kind:   MouseDown, // EVENT_MOUSE_PRESSED
+		OSTime: uint64(ms.time),
 		Mask:   winModifiers,
 		Button: button,
 		Clicks: clickCount,
@@ -477,8 +450,9 @@ func processButtonPressed(ms *msLLHookStruct, button uint16) {
 }
 
 func processButtonReleased(ms *msLLHookStruct, button uint16) {
-	send(Event{
+	sendFrom(ms.flags&llmhfInjected != 0, Event{
 		Kind:   MouseHold, // EVENT_MOUSE_RELEASED
+		OSTime: uint64(ms.time),
 		Mask:   winModifiers,
 		Button: button,
 		Clicks: clickCount,
@@ -488,8 +462,9 @@ func processButtonReleased(ms *msLLHookStruct, button uint16) {
 
 	// A press+release at the same point is also a "click".
 	if lastClickX == ms.pt.x && lastClickY == ms.pt.y {
-		send(Event{
+		sendFrom(ms.flags&llmhfInjected != 0, Event{
 			Kind:   MouseUp, // EVENT_MOUSE_CLICKED
+			OSTime: uint64(ms.time),
 			Mask:   winModifiers,
 			Button: button,
 			Clicks: clickCount,
@@ -515,8 +490,9 @@ func processMouseMoved(ms *msLLHookStruct) {
 		kind = MouseDrag
 	}
 
-	send(Event{
+	sendFrom(ms.flags&llmhfInjected != 0, Event{
 		Kind:   kind,
+		OSTime: uint64(ms.time),
 		Mask:   winModifiers,
 		Button: 0, // MOUSE_NOBUTTON
 		X:      int16(ms.pt.x),
@@ -533,8 +509,9 @@ func processMouseWheel(ms *msLLHookStruct, direction uint8) {
 	delta := int16(uint16(ms.mouseData >> 16))
 	rotation := int32(delta/wheelDelta) * -1
 
-	send(Event{
+	sendFrom(ms.flags&llmhfInjected != 0, Event{
 		Kind:      MouseWheel,
+		OSTime:    uint64(ms.time),
 		Mask:      winModifiers,
 		Clicks:    clickCount,
 		X:         int16(ms.pt.x),
@@ -545,6 +522,16 @@ func processMouseWheel(ms *msLLHookStruct, direction uint8) {
 	})
 }
 
+// sendFrom sends e, marked synthetic when the hook struct flags say it was
+// injected. This backend has no Post, so injected input is another
+// program's.
+func sendFrom(injected bool, e Event) {
+	if injected {
+		e.Synthetic, e.Source = true, SourceOther
+	}
+	send(e)
+}
+
 // setKeyModifier maintains winModifiers for the modifier/lock keys, mirroring
 // the CGo backend's set/unset_modifier_mask logic.
 func setKeyModifier(vkCode uint32, down bool) {
@@ -659,24 +646,6 @@ func wheelAmount() uint16 {
 	return 3
 }
 
-// send timestamps and pushes an event onto the global channel without blocking
-// the hook callback (a blocked LL hook stalls all system input and is silently
-// torn down by Windows). The recover guards the small shutdown window where
-// End() may have closed ev while a callback is still in flight.
-func send(e Event) {
-	if !asyncon {
-		return
-	}
-	defer func() { _ = recover() }() // ev closed by End(): drop silently
-
-	e.When = time.Now()
-	select {
-	case ev <- e:
-	default:
-		// channel full: drop rather than stalling the Windows input queue.
-	}
-}
-
 // winVKToKeycode maps a Windows virtual-key code to the libuiohook
 // VC_* "virtual code" (== github.com/vcaesar/keycode Keycode values),
 // mirroring keycode_to_scancode() in hook/windows/input_c.h. Generated by
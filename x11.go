@@ -41,16 +41,18 @@ package hook
 import (
 	"encoding/binary"
 	"errors"
+	"fmt"
 	"io"
 	"net"
 	"os"
 	"strconv"
 	"strings"
-	"time"
+	"sync"
 
 	"github.com/jezek/xgb"
 	"github.com/jezek/xgb/record"
 	"github.com/jezek/xgb/xproto"
+	"github.com/jezek/xgb/xtest"
 )
 
 // X keycodes are offset by 8 from Linux evdev codes on modern servers. The
@@ -58,9 +60,63 @@ import (
 // Event.Keycode/Event.Rawcode as evdev = X keycode - evdevOffset.
 const evdevOffset = 8
 
+// evdevCodes maps the libuiohook keycodes that are not the evdev code of
+// their key, the extended keys, to that code (linux/input-event-codes.h).
+// The other keycodes are evdev codes.
+var evdevCodes = map[uint16]uint16{
+	0x0E1C: 96,  // VC_KP_ENTER: KEY_KPENTER
+	0x0E1D: 97,  // VC_CONTROL_R: KEY_RIGHTCTRL
+	0x0E35: 98,  // VC_KP_DIVIDE: KEY_KPSLASH
+	0x0E37: 99,  // VC_PRINTSCREEN: KEY_SYSRQ
+	0x0E38: 100, // VC_ALT_R: KEY_RIGHTALT
+	0x0E47: 102, // VC_HOME: KEY_HOME
+	0xE048: 103, // VC_UP: KEY_UP
+	0x0E49: 104, // VC_PAGE_UP: KEY_PAGEUP
+	0xE04B: 105, // VC_LEFT: KEY_LEFT
+	0xE04D: 106, // VC_RIGHT: KEY_RIGHT
+	0x0E4F: 107, // VC_END: KEY_END
+	0xE050: 108, // VC_DOWN: KEY_DOWN
+	0x0E51: 109, // VC_PAGE_DOWN: KEY_PAGEDOWN
+	0x0E52: 110, // VC_INSERT: KEY_INSERT
+	0x0E53: 111, // VC_DELETE: KEY_DELETE
+	0x0E5B: 125, // VC_META_L: KEY_LEFTMETA
+	0x0E5C: 126, // VC_META_R: KEY_RIGHTMETA
+	0x0E5D: 127, // VC_CONTEXT_MENU: KEY_COMPOSE
+}
+
+// uiohookCodes is the inverse of evdevCodes.
+var uiohookCodes = func() map[uint16]uint16 {
+	m := make(map[uint16]uint16, len(evdevCodes))
+	for vc, evdev := range evdevCodes {
+		m[evdev] = vc
+	}
+	return m
+}()
+
+// x11Keycode returns the X keycode of the key with the libuiohook keycode
+// code, or false if X has no keycode for it.
+func x11Keycode(code uint16) (byte, bool) {
+	if evdev, ok := evdevCodes[code]; ok {
+		code = evdev
+	}
+	if code == 0 || int(code)+evdevOffset > 0xff {
+		return 0, false
+	}
+	return byte(code + evdevOffset), true
+}
+
 // EnableContext minor opcode in the RECORD extension (record.xml).
 const recordEnableContext = 5
 
+// FakeInput minor opcode in the XTEST extension (xtest.xml).
+const xtestFakeInput = 2
+
+// RECORD reply categories (record.xml): recorded events and requests.
+const (
+	recordFromServer = 0
+	recordFromClient = 1
+)
+
 // X11 keyboard modifier bits (KeyButMask*, xproto). Used to fill Event.Mask
 // and to pick the shifted keysym column for Keychar.
 const (
@@ -68,30 +124,32 @@ const (
 	xLockMask    = 1 << 1 // caps lock
 	xControlMask = 1 << 2
 	xMod1Mask    = 1 << 3 // typically Alt
+	xMod2Mask    = 1 << 4 // typically NumLock
 	xMod4Mask    = 1 << 6 // typically Super/Meta
 )
 
-// gohook virtual modifier masks (mirrors hook/iohook.h MASK_* for Event.Mask).
-const (
-	maskShiftL   uint16 = 1 << 0
-	maskCtrlL    uint16 = 1 << 1
-	maskMetaL    uint16 = 1 << 2
-	maskAltL     uint16 = 1 << 3
-	maskCapsLock uint16 = 1 << 14
-)
-
-// libuiohook-compatible scroll directions (matches the CGo backend).
-const (
-	wheelVertical   uint8 = 3
-	wheelHorizontal uint8 = 4
-)
-
-// x11State holds the live connection objects for the running session so End()
-// can tear them down. Guarded by the package-level lck mutex.
+// x11State holds the live connection objects for the running session so
+// stopBackend() can tear them down. Guarded by the package-level lck mutex.
 type x11State struct {
 	ctrl *xgb.Conn // control connection (record context lifecycle, keymap)
 	data net.Conn  // raw data connection streaming RECORD replies
 	ctx  record.Context
+	root xproto.Window
+
+	// xtest reports whether the control connection has the XTEST extension,
+	// used by Post.
+	xtest bool
+
+	// XTEST attribution, used by the read loop only. RECORD also records
+	// the FakeInput requests of every client, and the server generates the
+	// fake device event while it runs the request, so the event recorded
+	// right after a FakeInput is its result. selfBase is the resource id
+	// base of the control connection, which Post uses.
+	xtestOp  byte
+	selfBase uint32
+	fake     *x11Fake
+	source   Source // of the event being dispatched
+	time     uint32 // its X server time
 
 	// keyboard mapping snapshot for keysym -> Keychar resolution.
 	keysyms    []xproto.Keysym
@@ -101,35 +159,59 @@ type x11State struct {
 	// per-X-keycode pressed state, used to distinguish KeyDown vs KeyHold
 	// (X delivers auto-repeat as additional KeyPress events).
 	down map[byte]bool
+
+	// RegisterGrab's passive grabs, counting the bindings that use each.
+	grabMu sync.Mutex
+	grabs  map[x11Grab]int
+
+	// kinds are the event kinds the RECORD context covers.
+	kindMu sync.Mutex
+	kinds  kindSet
 }
 
 var xst *x11State
 
-// Start adds the X11 RECORD listener and returns the event channel.
+// x11Grab is a passive grab of a key or button with core modifiers on the
+// root window.
+type x11Grab struct {
+	button bool
+	detail byte
+	mods   uint16
+}
+
+// x11GrabButtons are the X buttons of the mouse tokens.
+var x11GrabButtons = map[string]byte{
+	"mleft": 1, "center": 2, "mright": 3,
+	"wheelUp": 4, "wheelDown": 5, "wheelLeft": 6, "wheelRight": 7,
+	"mback": 8, "mforward": 9,
+}
+
+// x11Fake is a recorded XTEST FakeInput request awaiting its device event.
+type x11Fake struct {
+	typ, detail byte
+	x, y        int16
+	src         Source
+}
+
+// backendName names this backend in Snapshot.
+const backendName = "x11"
+
+// osTime maps the X server time of the recorded events, in milliseconds.
+var osTime = newOSClock(1e6, 1, true)
+
+// runBackend runs the X11 RECORD listener until stopBackend is called.
 //
 // The optional timeout argument is accepted for API parity with the CGo
 // backend but is ignored: this backend is event-driven (it blocks on the
 // data socket) rather than polled.
-func Start(tm ...int) chan Event {
+func runBackend(tm ...int) {
 	_ = tm
 
-	ev = make(chan Event, 1024)
-	asyncon = true
-
-	go x11Loop()
-
-	return ev
+	x11Loop()
 }
 
-// End removes the X11 RECORD listener and resets all hook state.
-func End(tm ...int) {
-	tm1 := 10
-	if len(tm) > 0 {
-		tm1 = tm[0]
-	}
-
-	asyncon = false
-
+// stopBackend removes the X11 RECORD listener.
+func stopBackend() {
 	lck.Lock()
 	st := xst
 	xst = nil
@@ -138,15 +220,78 @@ func End(tm ...int) {
 	if st != nil {
 		x11Teardown(st)
 	}
+}
+
+// subscribe sets the running RECORD context to kinds. On failure the
+// context keeps its ranges.
+func subscribe(kinds kindSet) error {
+	lck.Lock()
+	st := xst
+	lck.Unlock()
+
+	if st == nil {
+		return nil
+	}
+	// kinds is wanted, which st.subscribe reads itself.
+	if err := st.subscribe(); err != nil {
+		return wrapErr(ErrRecordContext, err)
+	}
+	return nil
+}
 
-	time.Sleep(time.Millisecond * time.Duration(tm1))
+// subscribe re-registers the clients of the RECORD context with the ranges
+// of the wanted kinds if they changed. It reads wanted under kindMu, so the
+// last of racing calls registers the latest kinds.
+func (st *x11State) subscribe() error {
+	st.kindMu.Lock()
+	defer st.kindMu.Unlock()
 
-	for len(ev) != 0 {
-		<-ev
+	next := kindSet(wanted.Load())
+	if next == st.kinds {
+		return nil
 	}
-	close(ev)
 
-	resetState()
+	specs := []record.ClientSpec{record.ClientSpec(record.CsAllClients)}
+	ranges := x11Ranges(next, st.xtest, st.xtestOp)
+	err := record.RegisterClientsChecked(st.ctrl, st.ctx, 0,
+		uint32(len(specs)), uint32(len(ranges)), specs, ranges).Check()
+	if err == nil {
+		st.kinds = next
+	}
+	return err
+}
+
+// x11Ranges returns the RECORD ranges for kinds: the key, button and motion
+// device events each kind needs (KeyPress..KeyRelease, ButtonPress..
+// ButtonRelease, MotionNotify), and with XTEST the FakeInput requests to
+// attribute the events they generate.
+func x11Ranges(kinds kindSet, hasXTest bool, op byte) []record.Range {
+	var groups [][2]byte
+	add := func(set kindSet, first, last byte) {
+		if kinds&set == 0 {
+			return
+		}
+		if n := len(groups); n > 0 && groups[n-1][1]+1 == first {
+			groups[n-1][1] = last
+			return
+		}
+		groups = append(groups, [2]byte{first, last})
+	}
+	add(keyKinds, xproto.KeyPress, xproto.KeyRelease)
+	add(buttonKinds, xproto.ButtonPress, xproto.ButtonRelease)
+	add(motionKinds, xproto.MotionNotify, xproto.MotionNotify)
+
+	ranges := make([]record.Range, max(len(groups), 1))
+	for i, g := range groups {
+		ranges[i].DeviceEvents = record.Range8{First: g[0], Last: g[1]}
+	}
+	if hasXTest {
+		ranges[0].ExtRequests = record.ExtRange{
+			Major: record.Range8{First: op, Last: op},
+			Minor: record.Range16{First: xtestFakeInput, Last: xtestFakeInput},
+		}
+	}
+	return ranges
 }
 
 // addEvent: the single-shot *blocking* listener (AddEvent/StopEvent) is a
@@ -162,69 +307,301 @@ func addEvent(key string) int {
 // StopEvent is a no-op on the pure-Go X11 backend (see addEvent).
 func StopEvent() {}
 
-// x11Loop opens the control connection, creates the RECORD context, opens the
-// raw data connection and pumps the intercepted-event stream until End() tears
-// the connections down.
+// postEvent posts ev through the XTEST extension on the running hook's
+// control connection.
+func postEvent(ev Event) error {
+	lck.Lock()
+	st := xst
+	lck.Unlock()
+
+	if st == nil {
+		return ErrNotRunning
+	}
+	if !st.xtest {
+		return wrapErr(ErrNotSupported, errors.New("no XTEST extension"))
+	}
+
+	fake := func(typ, detail byte, x, y int16) error {
+		return xtest.FakeInputChecked(st.ctrl, typ, detail, 0, st.root, x, y, 0).Check()
+	}
+
+	switch ev.Kind {
+	case KeyDown, KeyUp:
+		xkc, ok := x11Keycode(ev.Keycode)
+		if !ok {
+			return fmt.Errorf("%w: no X keycode for keycode %#x", ErrNotSupported, ev.Keycode)
+		}
+		typ := byte(xproto.KeyPress)
+		if ev.Kind == KeyUp {
+			typ = xproto.KeyRelease
+		}
+		return fake(typ, xkc, 0, 0)
+
+	case MouseMove, MouseDrag:
+		return fake(xproto.MotionNotify, 0, ev.X, ev.Y)
+	}
+
+	// Buttons and the wheel act at the event's position.
+	if err := fake(xproto.MotionNotify, 0, ev.X, ev.Y); err != nil {
+		return err
+	}
+
+	if ev.Kind == MouseWheel {
+		btn := x11WheelButton(ev)
+		for range max(ev.Rotation, -ev.Rotation, 1) {
+			if err := fake(xproto.ButtonPress, btn, 0, 0); err != nil {
+				return err
+			}
+			if err := fake(xproto.ButtonRelease, btn, 0, 0); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	typ := byte(xproto.ButtonPress)
+	if ev.Kind == MouseUp {
+		typ = xproto.ButtonRelease
+	}
+	return fake(typ, x11ButtonOf(ev.Button), 0, 0)
+}
+
+// grabHotkey installs the passive grabs for hk on the running hook's
+// control connection, returning the function that releases them.
+func grabHotkey(hk Hotkey) (release func(), err error) {
+	lck.Lock()
+	st := xst
+	lck.Unlock()
+
+	if st == nil {
+		return nil, ErrNotRunning
+	}
+
+	g := x11Grab{mods: x11ModMask(hk.Mods)}
+	if btn, ok := x11GrabButtons[hk.Key]; ok {
+		g.button, g.detail = true, btn
+	} else if code, ok := Keycode[hk.Key]; !ok {
+		return nil, fmt.Errorf("%w %q", ErrUnknownKey, hk.Key)
+	} else if g.detail, ok = x11Keycode(code); !ok {
+		return nil, fmt.Errorf("%w: no X keycode for %q", ErrNotSupported, hk.Key)
+	}
+
+	st.grabMu.Lock()
+	defer st.grabMu.Unlock()
+	if st.grabs[g] == 0 {
+		if err := st.grab(g); err != nil {
+			return nil, err
+		}
+	}
+	st.grabs[g]++
+
+	var once sync.Once
+	return func() {
+		once.Do(func() { st.release(g) })
+	}, nil
+}
+
+// x11ModMask returns the core modifier mask of mods. Core modifiers have
+// no sides.
+func x11ModMask(mods Modifier) uint16 {
+	var mask uint16
+	if mods&ModShift != 0 {
+		mask |= xShiftMask
+	}
+	if mods&ModCtrl != 0 {
+		mask |= xControlMask
+	}
+	if mods&ModAlt != 0 {
+		mask |= xMod1Mask
+	}
+	if mods&ModCmd != 0 {
+		mask |= xMod4Mask
+	}
+	return mask
+}
+
+// lockMasks returns the lock modifier combinations a grab must cover to
+// work whatever the state of NumLock and CapsLock.
+func (st *x11State) lockMasks() []uint16 {
+	num := st.numLockMask()
+	return []uint16{0, xLockMask, num, xLockMask | num}
+}
+
+// numLockMask returns the modifier bit Num_Lock is mapped to, Mod2 unless
+// the modifier mapping says otherwise.
+func (st *x11State) numLockMask() uint16 {
+	const xkNumLock = 0xff7f
+
+	reply, err := xproto.GetModifierMapping(st.ctrl).Reply()
+	if err != nil || reply.KeycodesPerModifier == 0 {
+		return xMod2Mask
+	}
+
+	per := int(reply.KeycodesPerModifier)
+	for i, kc := range reply.Keycodes {
+		if kc != 0 && st.keysymAt(byte(kc), 0) == xkNumLock {
+			return 1 << (i / per)
+		}
+	}
+	return xMod2Mask
+}
+
+// grab installs g for every lock combination. A grab another client holds
+// is reported as ErrGrabConflict, after undoing the others.
+func (st *x11State) grab(g x11Grab) error {
+	var cookies []*xgb.Cookie
+	for _, lock := range st.lockMasks() {
+		mods := g.mods | lock
+		if g.button {
+			cookies = append(cookies, xproto.GrabButtonChecked(st.ctrl, false,
+				st.root, xproto.EventMaskButtonPress|xproto.EventMaskButtonRelease,
+				xproto.GrabModeAsync, xproto.GrabModeAsync, 0, 0, g.detail, mods).Cookie)
+		} else {
+			cookies = append(cookies, xproto.GrabKeyChecked(st.ctrl, false,
+				st.root, mods, xproto.Keycode(g.detail),
+				xproto.GrabModeAsync, xproto.GrabModeAsync).Cookie)
+		}
+	}
+
+	var err error
+	for _, c := range cookies {
+		if e := c.Check(); e != nil && err == nil {
+			err = e
+		}
+	}
+	if err == nil {
+		return nil
+	}
+
+	st.ungrab(g)
+	if _, ok := err.(xproto.AccessError); ok {
+		return wrapErr(ErrGrabConflict, err)
+	}
+	return wrapErr(ErrBackend, err)
+}
+
+// ungrab removes g for every lock combination. It only affects our own
+// grabs.
+func (st *x11State) ungrab(g x11Grab) {
+	for _, lock := range st.lockMasks() {
+		if g.button {
+			xproto.UngrabButton(st.ctrl, g.detail, st.root, g.mods|lock)
+		} else {
+			xproto.UngrabKey(st.ctrl, xproto.Keycode(g.detail), st.root, g.mods|lock)
+		}
+	}
+}
+
+// release drops one binding's use of g, removing the grab with the last.
+func (st *x11State) release(g x11Grab) {
+	st.grabMu.Lock()
+	defer st.grabMu.Unlock()
+
+	if st.grabs[g]--; st.grabs[g] > 0 {
+		return
+	}
+	delete(st.grabs, g)
+
+	lck.Lock()
+	live := xst == st
+	lck.Unlock()
+	if live {
+		// Otherwise the grabs went with the connection.
+		st.ungrab(g)
+	}
+}
+
+// x11Loop opens the raw data connection and the control connection, creates
+// the RECORD context and pumps the intercepted-event stream until
+// stopBackend() tears the connections down. Failures are reported through
+// fail() as the matching Err* error.
 func x11Loop() {
+	// The data connection is dialed first: its hand-rolled setup tells a
+	// missing display apart from a refused authentication.
+	data, err := x11DialAuth()
+	if err != nil {
+		fail(err)
+		return
+	}
+
 	ctrl, err := xgb.NewConn()
 	if err != nil {
-		// No X server / not an X session: report disabled and bail.
-		send(Event{Kind: HookDisabled})
+		data.Close()
+		fail(wrapErr(ErrNoDisplay, err))
 		return
 	}
 
 	if err := record.Init(ctrl); err != nil {
-		send(Event{Kind: HookDisabled})
+		data.Close()
 		ctrl.Close()
+		fail(wrapErr(ErrRecordUnavailable, err))
 		return
 	}
 
 	ctx, err := record.NewContextId(ctrl)
 	if err != nil {
-		send(Event{Kind: HookDisabled})
+		data.Close()
 		ctrl.Close()
+		fail(wrapErr(ErrRecordContext, err))
 		return
 	}
 
-	// Capture device events 2..6: KeyPress, KeyRelease, ButtonPress,
-	// ButtonRelease, MotionNotify — from all clients (current and future).
-	rng := record.Range{}
-	rng.DeviceEvents = record.Range8{First: xproto.KeyPress, Last: xproto.MotionNotify}
+	// Capture the wanted device events from all clients (current and
+	// future), see x11Ranges.
+	st := &x11State{ctrl: ctrl, data: data, ctx: ctx,
+		down: make(map[byte]bool), grabs: make(map[x11Grab]int)}
+	st.xtest = xtest.Init(ctrl) == nil
+	st.xtestOp = extOpcode(ctrl, "XTEST")
+	st.kinds = kindSet(wanted.Load())
 	specs := []record.ClientSpec{record.ClientSpec(record.CsAllClients)}
-	ranges := []record.Range{rng}
+	ranges := x11Ranges(st.kinds, st.xtest, st.xtestOp)
 
 	if err := record.CreateContextChecked(ctrl, ctx, 0,
 		uint32(len(specs)), uint32(len(ranges)), specs, ranges).Check(); err != nil {
-		send(Event{Kind: HookDisabled})
+		data.Close()
 		ctrl.Close()
+		fail(wrapErr(ErrRecordContext, err))
 		return
 	}
 
-	st := &x11State{ctrl: ctrl, ctx: ctx, down: make(map[byte]bool)}
+	st.root = xproto.Setup(ctrl).DefaultScreen(ctrl).Root
+	st.selfBase = xproto.Setup(ctrl).ResourceIdBase
 	loadKeymap(st)
 
-	data, err := x11DialAuth()
-	if err != nil {
-		send(Event{Kind: HookDisabled})
-		record.FreeContext(ctrl, ctx)
-		ctrl.Close()
-		return
-	}
-	st.data = data
-
 	lck.Lock()
 	xst = st
 	lck.Unlock()
 
-	if err := x11EnableContext(data, recordOpcode(ctrl), ctx); err != nil {
-		send(Event{Kind: HookDisabled})
+	// A Hook that joined meanwhile may want more than the context has.
+	if err := st.subscribe(); err != nil {
+		x11Teardown(st)
+		fail(wrapErr(ErrRecordContext, err))
+		return
+	}
+
+	if err := x11EnableContext(data, extOpcode(ctrl, "RECORD"), ctx); err != nil {
 		x11Teardown(st)
+		fail(wrapErr(ErrRecordContext, err))
 		return
 	}
 
+	// Grabbed keys and buttons are delivered to the control connection;
+	// RECORD reports them, so discard the events until it closes.
+	go func() {
+		for {
+			ev, err := ctrl.WaitForEvent()
+			if ev == nil && err == nil {
+				return
+			}
+		}
+	}()
+
 	send(Event{Kind: HookEnabled})
 
-	x11ReadLoop(st)
+	if err := x11ReadLoop(st); err != nil && asyncon.Load() {
+		// The server went away rather than stopBackend() closing the socket.
+		fail(wrapErr(ErrNoDisplay, err))
+	}
 }
 
 // x11Teardown disables/frees the record context (over the control connection)
@@ -243,12 +620,12 @@ func x11Teardown(st *x11State) {
 	}
 }
 
-// recordOpcode returns the negotiated major opcode of the RECORD extension on
-// the given connection (set by record.Init).
-func recordOpcode(c *xgb.Conn) byte {
+// extOpcode returns the negotiated major opcode of an extension on the given
+// connection (set by the extension's Init).
+func extOpcode(c *xgb.Conn, name string) byte {
 	c.ExtLock.RLock()
 	defer c.ExtLock.RUnlock()
-	return c.Extensions["RECORD"]
+	return c.Extensions[name]
 }
 
 // loadKeymap snapshots the server keyboard mapping so key events can resolve a
@@ -290,13 +667,13 @@ func x11EnableContext(conn net.Conn, opcode byte, ctx record.Context) error {
 }
 
 // x11ReadLoop reads RECORD reply records off the raw data connection and
-// dispatches the device events they carry. It returns when the connection is
-// closed (by End()) or a read fails.
-func x11ReadLoop(st *x11State) {
+// dispatches the device events they carry. It returns the read error once the
+// connection is closed (by stopBackend()) or fails.
+func x11ReadLoop(st *x11State) error {
 	header := make([]byte, 32)
-	for asyncon {
+	for asyncon.Load() {
 		if _, err := io.ReadFull(st.data, header); err != nil {
-			return
+			return err
 		}
 
 		// We only expect replies (1) on the data connection. Errors (0) and
@@ -311,18 +688,22 @@ func x11ReadLoop(st *x11State) {
 		if length > 0 {
 			data = make([]byte, length*4)
 			if _, err := io.ReadFull(st.data, data); err != nil {
-				return
+				return err
 			}
 		}
 
-		// Category 0 (FromServer) carries the intercepted device events.
+		// FromServer carries the intercepted device events, FromClient the
+		// XTEST requests with the sending client's resource id base.
 		// StartOfData (4) and EndOfData (5) are skipped.
-		if header[1] != 0 {
-			continue
+		switch header[1] {
+		case recordFromServer:
+			x11Dispatch(st, data)
+		case recordFromClient:
+			x11OnRequests(st, data, xgb.Get32(header[12:]), header[9] != 0)
 		}
-
-		x11Dispatch(st, data)
 	}
+
+	return nil
 }
 
 // x11Dispatch walks the 32-byte X event records packed in a RECORD data block
@@ -330,6 +711,8 @@ func x11ReadLoop(st *x11State) {
 func x11Dispatch(st *x11State, data []byte) {
 	for i := 0; i+32 <= len(data); i += 32 {
 		buf := data[i : i+32]
+		st.source = st.attribute(buf)
+		st.time = xgb.Get32(buf[4:])
 		switch buf[0] & 0x7f {
 		case xproto.KeyPress:
 			x11OnKey(st, buf, true)
@@ -340,11 +723,75 @@ func x11Dispatch(st *x11State, data []byte) {
 		case xproto.ButtonRelease:
 			x11OnButton(st, buf, false)
 		case xproto.MotionNotify:
-			x11OnMotion(buf)
+			x11OnMotion(st, buf)
 		}
 	}
 }
 
+// x11OnRequests records the XTEST FakeInput requests in a FromClient block,
+// sent by the client with resource id base idBase. swapped reports a client
+// of the other byte order.
+func x11OnRequests(st *x11State, data []byte, idBase uint32, swapped bool) {
+	get16 := func(b []byte) uint16 {
+		if swapped {
+			return uint16(b[0])<<8 | uint16(b[1])
+		}
+		return xgb.Get16(b)
+	}
+
+	for len(data) >= 4 {
+		n := int(get16(data[2:])) * 4
+		if n < 4 || n > len(data) {
+			return // BIG-REQUESTS length or a truncated block
+		}
+		req := data[:n]
+		data = data[n:]
+
+		if !st.xtest || req[0] != st.xtestOp || req[1] != xtestFakeInput || len(req) < 28 {
+			continue
+		}
+		f := &x11Fake{typ: req[4], detail: req[5], src: SourceOther,
+			x: int16(get16(req[24:])), y: int16(get16(req[26:]))}
+		if idBase == st.selfBase {
+			f.src = SourceSelf
+		}
+		st.fake = f
+	}
+}
+
+// attribute returns the source of a recorded device event, consuming the
+// pending FakeInput: the event is its result if it matches, and a request
+// that generated nothing (a motion to the pointer's position) must not
+// claim a later event.
+func (st *x11State) attribute(buf []byte) Source {
+	f := st.fake
+	st.fake = nil
+	if f == nil || f.typ != buf[0]&0x7f {
+		return SourceDevice
+	}
+
+	if f.typ == xproto.MotionNotify {
+		me := xproto.MotionNotifyEventNew(buf).(xproto.MotionNotifyEvent)
+		// Relative motion (detail 1) cannot be checked by position.
+		if f.detail == 0 && (me.RootX != f.x || me.RootY != f.y) {
+			return SourceDevice
+		}
+	} else if f.detail != buf[1] {
+		return SourceDevice
+	}
+	return f.src
+}
+
+// send emits e, tagged with the source and time of the event being
+// dispatched.
+func (st *x11State) send(e Event) {
+	e.OSTime = uint64(st.time)
+	if st.source != SourceDevice {
+		e.Synthetic, e.Source = true, st.source
+	}
+	send(e)
+}
+
 // x11OnKey emits KeyDown/KeyHold/KeyUp from a recorded key event.
 func x11OnKey(st *x11State, buf []byte, press bool) {
 	ke := xproto.KeyPressEventNew(buf).(xproto.KeyPressEvent)
@@ -365,11 +812,14 @@ func x11OnKey(st *x11State, buf []byte, press bool) {
 		Rawcode: uint16(ks),
 		Keycode: evdev,
 		Keychar: CharUndefined,
-		Mask:    maskFromState(ke.State),
+	}
+	if vc, ok := uiohookCodes[evdev]; ok {
+		e.Keycode = vc
 	}
 
 	if press {
 		lck.Lock()
+		e.Mask = maskFromState(ke.State, st.down)
 		if st.down[xkc] {
 			e.Kind = KeyHold
 		} else {
@@ -380,6 +830,7 @@ func x11OnKey(st *x11State, buf []byte, press bool) {
 	} else {
 		e.Kind = KeyUp
 		lck.Lock()
+		e.Mask = maskFromState(ke.State, st.down)
 		delete(st.down, xkc)
 		lck.Unlock()
 	}
@@ -395,7 +846,7 @@ func x11OnKey(st *x11State, buf []byte, press bool) {
 		}
 	}
 
-	send(e)
+	st.send(e)
 }
 
 // x11OnButton emits MouseDown/MouseUp, or MouseWheel for the scroll-wheel
@@ -404,7 +855,9 @@ func x11OnButton(st *x11State, buf []byte, press bool) {
 	be := xproto.ButtonPressEventNew(buf).(xproto.ButtonPressEvent)
 	btn := byte(be.Detail)
 	x, y := be.RootX, be.RootY
-	mask := maskFromState(be.State)
+	lck.Lock()
+	mask := maskFromState(be.State, st.down)
+	lck.Unlock()
 
 	// X delivers wheel scrolls as button 4/5 (vertical) and 6/7 (horizontal)
 	// press+release pairs. Emit a single MouseWheel on press; drop the release.
@@ -412,7 +865,7 @@ func x11OnButton(st *x11State, buf []byte, press bool) {
 		if !press {
 			return
 		}
-		send(x11Wheel(btn, x, y, mask))
+		st.send(x11Wheel(btn, x, y, mask))
 		return
 	}
 
@@ -421,7 +874,7 @@ func x11OnButton(st *x11State, buf []byte, press bool) {
 		kind = MouseUp
 	}
 
-	send(Event{
+	st.send(Event{
 		Kind:   kind,
 		Button: x11Button(btn),
 		Clicks: 1,
@@ -433,9 +886,9 @@ func x11OnButton(st *x11State, buf []byte, press bool) {
 
 // x11OnMotion emits MouseMove using the absolute root-window coordinates that
 // the recorded core motion event carries.
-func x11OnMotion(buf []byte) {
+func x11OnMotion(st *x11State, buf []byte) {
 	me := xproto.MotionNotifyEventNew(buf).(xproto.MotionNotifyEvent)
-	send(Event{Kind: MouseMove, X: me.RootX, Y: me.RootY})
+	st.send(Event{Kind: MouseMove, X: me.RootX, Y: me.RootY})
 }
 
 // x11Button maps an X core button number to a gohook MouseMap code.
@@ -447,11 +900,41 @@ func x11Button(btn byte) uint16 {
 		return MouseMap["center"] // X middle button
 	case 3:
 		return MouseMap["right"]
+	case 8, 9: // back and forward, as in the CGo backend
+		return uint16(btn) - 4
 	default:
 		return uint16(btn)
 	}
 }
 
+// x11ButtonOf maps a gohook MouseMap code back to an X core button number.
+func x11ButtonOf(button uint16) byte {
+	switch button {
+	case MouseMap["center"]:
+		return 2
+	case MouseMap["right"]:
+		return 3
+	case 4, 5:
+		return byte(button) + 4
+	default:
+		return byte(button)
+	}
+}
+
+// x11WheelButton returns the X scroll pseudo-button for a MouseWheel event.
+func x11WheelButton(ev Event) byte {
+	if ev.Direction == wheelHorizontal {
+		if ev.Rotation < 0 {
+			return 6
+		}
+		return 7
+	}
+	if ev.Rotation < 0 {
+		return 4
+	}
+	return 5
+}
+
 // x11Wheel builds a MouseWheel Event for an X scroll pseudo-button.
 func x11Wheel(btn byte, x, y int16, mask uint16) Event {
 	e := Event{Kind: MouseWheel, X: x, Y: y, Clicks: 1, Amount: 1, Mask: mask}
@@ -526,20 +1009,45 @@ func keysymToRune(ks xproto.Keysym) rune {
 	}
 }
 
-// maskFromState maps X11 modifier state bits to gohook's virtual mask.
-func maskFromState(state uint16) uint16 {
-	var m uint16
-	if state&xShiftMask != 0 {
-		m |= maskShiftL
-	}
-	if state&xControlMask != 0 {
-		m |= maskCtrlL
-	}
-	if state&xMod4Mask != 0 {
-		m |= maskMetaL
+// x11Mods maps the evdev codes of the modifier keys to their Event.Mask bit.
+var x11Mods = map[uint16]uint16{
+	29:  maskCtrlL,  // KEY_LEFTCTRL
+	97:  maskCtrlR,  // KEY_RIGHTCTRL
+	42:  maskShiftL, // KEY_LEFTSHIFT
+	54:  maskShiftR, // KEY_RIGHTSHIFT
+	56:  maskAltL,   // KEY_LEFTALT
+	100: maskAltR,   // KEY_RIGHTALT
+	125: maskMetaL,  // KEY_LEFTMETA
+	126: maskMetaR,  // KEY_RIGHTMETA
+}
+
+// maskFromState maps X11 modifier state bits to gohook's virtual mask. The
+// state does not say which side of a modifier is held, so the side is taken
+// from the X keycodes in down; a modifier held since before the hook
+// started is reported as the left one.
+func maskFromState(state uint16, down map[byte]bool) uint16 {
+	var sides uint16
+	for xkc := range down {
+		if int(xkc) >= evdevOffset {
+			sides |= x11Mods[uint16(xkc)-evdevOffset]
+		}
 	}
-	if state&xMod1Mask != 0 {
-		m |= maskAltL
+
+	var m uint16
+	for _, v := range []struct{ x, mask, left uint16 }{
+		{xShiftMask, maskShift, maskShiftL},
+		{xControlMask, maskCtrl, maskCtrlL},
+		{xMod4Mask, maskMeta, maskMetaL},
+		{xMod1Mask, maskAlt, maskAltL},
+	} {
+		if state&v.x == 0 {
+			continue
+		}
+		if s := sides & v.mask; s != 0 {
+			m |= s
+		} else {
+			m |= v.left
+		}
 	}
 	if state&xLockMask != 0 {
 		m |= maskCapsLock
@@ -547,24 +1055,6 @@ func maskFromState(state uint16) uint16 {
 	return m
 }
 
-// send timestamps and pushes an event onto the global channel. It drops the
-// event (rather than blocking the reader) if no consumer keeps up and the
-// buffer is full. The recover guards the small shutdown window where End() may
-// have closed ev while a read is still in flight.
-func send(e Event) {
-	if !asyncon {
-		return
-	}
-	defer func() { _ = recover() }() // ev closed by End(): drop silently
-
-	e.When = time.Now()
-	select {
-	case ev <- e:
-	default:
-		// channel full: drop to avoid stalling the reader.
-	}
-}
-
 // ---------------------------------------------------------------------------
 // Raw X11 data connection: dial + handshake + MIT-MAGIC-COOKIE-1 auth.
 //
@@ -574,16 +1064,17 @@ func send(e Event) {
 // ---------------------------------------------------------------------------
 
 // x11DialAuth dials the X server named by $DISPLAY and completes the X11
-// connection setup handshake, returning a ready-to-use socket.
+// connection setup handshake, returning a ready-to-use socket. Errors wrap
+// ErrNoDisplay or ErrAuthRefused.
 func x11DialAuth() (net.Conn, error) {
 	display := os.Getenv("DISPLAY")
 	if display == "" {
-		return nil, errors.New("hook: DISPLAY is not set")
+		return nil, wrapErr(ErrNoDisplay, errors.New("DISPLAY is not set"))
 	}
 
 	conn, host, dispNum, err := x11Dial(display)
 	if err != nil {
-		return nil, err
+		return nil, wrapErr(ErrNoDisplay, err)
 	}
 
 	if err := x11Handshake(conn, host, dispNum); err != nil {
@@ -648,7 +1139,8 @@ func x11Dial(display string) (conn net.Conn, host, dispNum string, err error) {
 // x11Handshake performs the X11 connection setup: it sends the client setup
 // (little-endian) with MIT-MAGIC-COOKIE-1 auth and verifies the server accepts
 // it. The setup reply body is read and discarded — the control connection
-// already exposes everything else we need.
+// already exposes everything else we need. A refused setup wraps
+// ErrAuthRefused.
 func x11Handshake(conn net.Conn, host, dispNum string) error {
 	name, data, err := x11Auth(host, dispNum)
 	if err != nil {
@@ -666,12 +1158,12 @@ func x11Handshake(conn net.Conn, host, dispNum string) error {
 	copy(buf[12+xgb.Pad(len(name)):], data)
 
 	if _, err := conn.Write(buf); err != nil {
-		return err
+		return wrapErr(ErrNoDisplay, err)
 	}
 
 	head := make([]byte, 8)
 	if _, err := io.ReadFull(conn, head); err != nil {
-		return err
+		return wrapErr(ErrNoDisplay, err)
 	}
 
 	code := head[0]
@@ -680,7 +1172,7 @@ func x11Handshake(conn net.Conn, host, dispNum string) error {
 
 	body := make([]byte, extra*4)
 	if _, err := io.ReadFull(conn, body); err != nil {
-		return err
+		return wrapErr(ErrNoDisplay, err)
 	}
 
 	// Setup status: 0 = Failed, 1 = Success, 2 = Authenticate (the server
@@ -690,12 +1182,12 @@ func x11Handshake(conn net.Conn, host, dispNum string) error {
 	case 1:
 		return nil
 	case 2:
-		return errors.New("hook: X server requires further authentication")
+		return wrapErr(ErrAuthRefused, errors.New("X server requires further authentication"))
 	default: // 0: Failed
 		if reasonLen > len(body) {
 			reasonLen = len(body)
 		}
-		return errors.New("hook: X authentication refused: " + string(body[:reasonLen]))
+		return wrapErr(ErrAuthRefused, errors.New(string(body[:reasonLen])))
 	}
 }
 
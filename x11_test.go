@@ -13,8 +13,16 @@
 package hook
 
 import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"os"
 	"testing"
+	"time"
 
+	"github.com/jezek/xgb"
+	"github.com/jezek/xgb/record"
 	"github.com/jezek/xgb/xproto"
 	"github.com/vcaesar/tt"
 )
@@ -46,6 +54,18 @@ func TestX11Button(t *testing.T) {
 	tt.Equal(t, MouseMap["right"], x11Button(3))
 }
 
+// TestX11ButtonOf verifies Post's button and wheel translation inverts the
+// recorded one.
+func TestX11ButtonOf(t *testing.T) {
+	for btn := byte(1); btn <= 9; btn++ {
+		if btn >= 4 && btn <= 7 {
+			tt.Equal(t, btn, x11WheelButton(x11Wheel(btn, 0, 0, 0)))
+			continue
+		}
+		tt.Equal(t, btn, x11ButtonOf(x11Button(btn)))
+	}
+}
+
 // TestX11Wheel verifies scroll pseudo-buttons map to MouseWheel with the right
 // direction and rotation sign.
 func TestX11Wheel(t *testing.T) {
@@ -69,12 +89,51 @@ func TestX11Wheel(t *testing.T) {
 
 // TestMaskFromState verifies X modifier bits map onto gohook's virtual mask.
 func TestMaskFromState(t *testing.T) {
-	tt.Equal(t, maskShiftL, maskFromState(xShiftMask))
-	tt.Equal(t, maskCtrlL, maskFromState(xControlMask))
-	tt.Equal(t, maskAltL, maskFromState(xMod1Mask))
-	tt.Equal(t, maskMetaL, maskFromState(xMod4Mask))
-	tt.Equal(t, maskCapsLock, maskFromState(xLockMask))
-	tt.Equal(t, maskShiftL|maskCtrlL, maskFromState(xShiftMask|xControlMask))
+	tt.Equal(t, maskShiftL, maskFromState(xShiftMask, nil))
+	tt.Equal(t, maskCtrlL, maskFromState(xControlMask, nil))
+	tt.Equal(t, maskAltL, maskFromState(xMod1Mask, nil))
+	tt.Equal(t, maskMetaL, maskFromState(xMod4Mask, nil))
+	tt.Equal(t, maskCapsLock, maskFromState(xLockMask, nil))
+	tt.Equal(t, maskShiftL|maskCtrlL, maskFromState(xShiftMask|xControlMask, nil))
+
+	// The held X keycodes (evdev + 8) pick the side.
+	rctrl, ralt, lalt := byte(97+evdevOffset), byte(100+evdevOffset), byte(56+evdevOffset)
+	tt.Equal(t, maskCtrlR, maskFromState(xControlMask, map[byte]bool{rctrl: true}))
+	tt.Equal(t, maskAltL|maskAltR,
+		maskFromState(xMod1Mask, map[byte]bool{ralt: true, lalt: true}))
+	// A held key only counts while X reports its modifier.
+	tt.Equal(t, uint16(0), maskFromState(0, map[byte]bool{rctrl: true}))
+}
+
+func TestX11Keycode(t *testing.T) {
+	xkc := func(code uint16) int {
+		k, ok := x11Keycode(code)
+		if !ok {
+			return -1
+		}
+		return int(k)
+	}
+
+	tt.Equal(t, 38, xkc(Keycode["a"]))
+	tt.Equal(t, 111, xkc(Keycode["up"]))
+	tt.Equal(t, 116, xkc(Keycode["down"]))
+	tt.Equal(t, 108, xkc(Keycode["altr"]))
+	tt.Equal(t, 133, xkc(Keycode["cmd"]))
+	tt.Equal(t, 105, xkc(vcCtrlR))
+	tt.Equal(t, 104, xkc(Keycode["num_enter"]))
+	tt.Equal(t, -1, xkc(0))
+	tt.Equal(t, -1, xkc(0x0E99))
+
+	// Every named key has an X keycode, which maps back to it.
+	for name, code := range Keycode {
+		k, ok := x11Keycode(code)
+		tt.Equal(t, true, ok, name)
+		evdev := uint16(k) - evdevOffset
+		if vc, ok := uiohookCodes[evdev]; ok {
+			evdev = vc
+		}
+		tt.Equal(t, code, evdev, name)
+	}
 }
 
 // TestKeysymAt exercises the keyboard-mapping index math, including
@@ -114,3 +173,250 @@ func TestX11Dial(t *testing.T) {
 	_, _, _, err = x11Dial(":")
 	tt.NotNil(t, err)
 }
+
+// TestX11Handshake checks that a setup refused by the server is reported as
+// ErrAuthRefused, using a fake server on the other end of a pipe.
+func TestX11Handshake(t *testing.T) {
+	t.Setenv("XAUTHORITY", "/nonexistent")
+
+	c, srv := net.Pipe()
+	defer c.Close()
+	go func() {
+		setup := make([]byte, 12)
+		if _, err := io.ReadFull(srv, setup); err != nil {
+			return
+		}
+
+		// Failed, 6-byte reason, protocol 11.0, 2 units of extra data.
+		reply := []byte{0, 6, 11, 0, 0, 0, 2, 0}
+		reply = append(reply, "denied\x00\x00"...)
+		srv.Write(reply)
+	}()
+
+	err := x11Handshake(c, "", "0")
+	tt.Equal(t, true, errors.Is(err, ErrAuthRefused))
+}
+
+// TestStartContext verifies a backend without a display is reported as
+// ErrNoDisplay rather than a bare HookDisabled event.
+func TestStartContext(t *testing.T) {
+	t.Setenv("DISPLAY", "")
+
+	h := New(Options{})
+	s, err := h.StartContext(context.Background())
+	tt.Nil(t, s)
+	tt.Equal(t, true, errors.Is(err, ErrNoDisplay))
+
+	// The failed Hook has been ended; ending it again is a no-op.
+	h.End()
+}
+
+// TestPost posts events through XTEST and checks they come back on the
+// Start channel. It needs an X server with RECORD and XTEST, such as Xvfb.
+func TestPost(t *testing.T) {
+	tt.Equal(t, true, errors.Is(Post(Event{Kind: KeyDown}), ErrNotRunning))
+	if os.Getenv("DISPLAY") == "" {
+		t.Skip("no X display")
+	}
+
+	h := New(Options{})
+	evs, err := h.StartContext(context.Background())
+	if err != nil {
+		t.Skip(err)
+	}
+	defer h.End()
+
+	// next returns the next event of the given kind, or fails the test.
+	next := func(kind uint8) Event {
+		timeout := time.After(2 * time.Second)
+		for {
+			select {
+			case ev := <-evs:
+				if ev.Kind == kind {
+					return ev
+				}
+			case <-timeout:
+				t.Fatalf("no event of kind %d", kind)
+			}
+		}
+	}
+
+	a := Keycode["a"]
+	tt.Nil(t, Post(Event{Kind: KeyDown, Keycode: a}))
+	down := next(KeyDown)
+	tt.Equal(t, a, down.Keycode)
+	tt.Equal(t, true, down.Synthetic)
+	tt.Equal(t, SourceSelf, down.Source)
+	tt.Nil(t, Post(Event{Kind: KeyUp, Keycode: a}))
+	tt.Equal(t, a, next(KeyUp).Keycode)
+
+	// Extended keys, whose keycodes are above the X keycode range.
+	for _, code := range []uint16{Keycode["up"], Keycode["left"],
+		Keycode["altr"], Keycode["cmd"], Keycode["cmdr"], vcCtrlR} {
+		tt.Nil(t, Post(Event{Kind: KeyDown, Keycode: code}))
+		tt.Equal(t, code, next(KeyDown).Keycode)
+		tt.Nil(t, Post(Event{Kind: KeyUp, Keycode: code}))
+		tt.Equal(t, code, next(KeyUp).Keycode)
+	}
+	tt.Equal(t, true, errors.Is(Post(Event{Kind: KeyDown, Keycode: 0x0E99}),
+		ErrNotSupported))
+
+	tt.Nil(t, Post(Event{Kind: MouseMove, X: 12, Y: 34}))
+	mv := next(MouseMove)
+	tt.Equal(t, int16(12), mv.X)
+	tt.Equal(t, int16(34), mv.Y)
+
+	right := MouseMap["right"]
+	tt.Nil(t, Post(Event{Kind: MouseDown, Button: right, X: 5, Y: 6}))
+	press := next(MouseDown)
+	tt.Equal(t, right, press.Button)
+	tt.Equal(t, int16(5), press.X)
+	tt.Nil(t, Post(Event{Kind: MouseUp, Button: right, X: 5, Y: 6}))
+	tt.Equal(t, right, next(MouseUp).Button)
+
+	tt.Nil(t, Post(Event{Kind: MouseWheel, Rotation: WheelUp}))
+	tt.Equal(t, int32(WheelUp), next(MouseWheel).Rotation)
+}
+
+// TestX11Attribute verifies recorded XTEST requests tag the device event
+// they generate, by the client that sent them.
+func TestX11Attribute(t *testing.T) {
+	st := &x11State{xtest: true, xtestOp: 140, selfBase: 0x400000}
+	req := func(typ, detail byte, x, y int16, swapped bool) []byte {
+		b := make([]byte, 36)
+		b[0], b[1], b[4], b[5] = 140, xtestFakeInput, typ, detail
+		if swapped {
+			b[3], b[24], b[25], b[26], b[27] = 9, byte(x>>8), byte(x), byte(y>>8), byte(y)
+		} else {
+			b[2] = 9
+			xgb.Put16(b[24:], uint16(x))
+			xgb.Put16(b[26:], uint16(y))
+		}
+		return b
+	}
+	ev := func(typ, detail byte, x, y int16) []byte {
+		b := make([]byte, 32)
+		b[0], b[1] = typ, detail
+		xgb.Put16(b[20:], uint16(x))
+		xgb.Put16(b[22:], uint16(y))
+		return b
+	}
+	key := ev(xproto.KeyPress, 38, 0, 0)
+
+	tt.Equal(t, SourceDevice, st.attribute(key))
+
+	x11OnRequests(st, req(xproto.KeyPress, 38, 0, 0, false), 0x400000, false)
+	tt.Equal(t, SourceSelf, st.attribute(key))
+	tt.Equal(t, SourceDevice, st.attribute(key))
+
+	x11OnRequests(st, req(xproto.KeyPress, 38, 0, 0, true), 0x600000, true)
+	tt.Equal(t, SourceOther, st.attribute(key))
+
+	// A fake that generated nothing claims no later event.
+	x11OnRequests(st, req(xproto.MotionNotify, 0, 5, 6, false), 0x400000, false)
+	tt.Equal(t, SourceDevice, st.attribute(key))
+	tt.Equal(t, SourceDevice, st.attribute(ev(xproto.MotionNotify, 0, 5, 6)))
+
+	x11OnRequests(st, req(xproto.MotionNotify, 0, 5, 6, true), 0x400000, true)
+	tt.Equal(t, SourceDevice, st.attribute(ev(xproto.MotionNotify, 0, 5, 7)))
+	x11OnRequests(st, req(xproto.MotionNotify, 0, 5, 6, true), 0x400000, true)
+	tt.Equal(t, SourceSelf, st.attribute(ev(xproto.MotionNotify, 0, 5, 6)))
+}
+
+func TestX11ModMask(t *testing.T) {
+	tt.Equal(t, uint16(0), x11ModMask(0))
+	tt.Equal(t, uint16(xControlMask|xMod1Mask), x11ModMask(ModCtrl|ModAlt))
+	// Either side maps onto the same core modifier.
+	tt.Equal(t, uint16(xShiftMask|xMod4Mask), x11ModMask(ModRShift|ModLCmd))
+}
+
+// TestRegisterGrabX11 grabs a hotkey, presses it through XTEST and checks
+// the callback runs, then checks a grab another client holds conflicts. It
+// needs an X server with RECORD and XTEST, such as Xvfb.
+func TestRegisterGrabX11(t *testing.T) {
+	_, err := RegisterGrab("Ctrl+Alt+T", func(e Event) {})
+	tt.Equal(t, true, errors.Is(err, ErrNotRunning))
+	if os.Getenv("DISPLAY") == "" {
+		t.Skip("no X display")
+	}
+
+	h := New(Options{})
+	evs, err := h.StartContext(context.Background())
+	if err != nil {
+		t.Skip(err)
+	}
+	defer h.End()
+
+	hit := make(chan Event, 1)
+	b, err := h.RegisterGrab("Ctrl+Alt+T", func(e Event) { hit <- e })
+	tt.Nil(t, err)
+	h.Process(evs)
+
+	ctrl, alt, key := Keycode["ctrl"], Keycode["alt"], Keycode["t"]
+	for _, ev := range []Event{
+		{Kind: KeyDown, Keycode: ctrl}, {Kind: KeyDown, Keycode: alt},
+		{Kind: KeyDown, Keycode: key}, {Kind: KeyUp, Keycode: key},
+		{Kind: KeyUp, Keycode: alt}, {Kind: KeyUp, Keycode: ctrl},
+	} {
+		tt.Nil(t, Post(ev))
+	}
+	select {
+	case e := <-hit:
+		tt.Equal(t, key, e.Keycode)
+	case <-time.After(2 * time.Second):
+		t.Fatal("grabbed hotkey did not fire")
+	}
+	b.Unregister()
+
+	// An arrow, whose keycode is above the X keycode range.
+	b, err = h.RegisterGrab("Ctrl+Up", func(e Event) { hit <- e })
+	tt.Nil(t, err)
+	up := Keycode["up"]
+	for _, ev := range []Event{
+		{Kind: KeyDown, Keycode: ctrl}, {Kind: KeyDown, Keycode: up},
+		{Kind: KeyUp, Keycode: up}, {Kind: KeyUp, Keycode: ctrl},
+	} {
+		tt.Nil(t, Post(ev))
+	}
+	select {
+	case e := <-hit:
+		tt.Equal(t, up, e.Keycode)
+	case <-time.After(2 * time.Second):
+		t.Fatal("grabbed arrow did not fire")
+	}
+	b.Unregister()
+
+	// Another client takes the combo first.
+	other, err := xgb.NewConn()
+	tt.Nil(t, err)
+	defer other.Close()
+	root := xproto.Setup(other).DefaultScreen(other).Root
+	tt.Nil(t, xproto.GrabKeyChecked(other, false, root, xControlMask|xShiftMask,
+		xproto.Keycode(Keycode["y"]+evdevOffset),
+		xproto.GrabModeAsync, xproto.GrabModeAsync).Check())
+
+	_, err = h.RegisterGrab("Ctrl+Shift+Y", func(e Event) {})
+	tt.Equal(t, true, errors.Is(err, ErrGrabConflict))
+}
+
+func TestX11Ranges(t *testing.T) {
+	dev := func(rs []record.Range) (out [][2]byte) {
+		for _, r := range rs {
+			out = append(out, [2]byte{r.DeviceEvents.First, r.DeviceEvents.Last})
+		}
+		return
+	}
+
+	tt.Equal(t, [][2]byte{{2, 6}}, dev(x11Ranges(allKinds, false, 0)))
+	tt.Equal(t, [][2]byte{{2, 3}}, dev(x11Ranges(kindsOf([]uint8{KeyDown}), false, 0)))
+	tt.Equal(t, [][2]byte{{4, 6}},
+		dev(x11Ranges(kindsOf([]uint8{MouseDown, MouseMove}), false, 0)))
+	tt.Equal(t, [][2]byte{{2, 3}, {6, 6}},
+		dev(x11Ranges(kindsOf([]uint8{KeyUp, MouseDrag}), false, 0)))
+	tt.Equal(t, [][2]byte{{0, 0}}, dev(x11Ranges(kindsOf([]uint8{HookEnabled}), false, 0)))
+
+	rs := x11Ranges(kindsOf([]uint8{KeyUp, MouseMove}), true, 140)
+	tt.Equal(t, byte(140), rs[0].ExtRequests.Major.First)
+	tt.Equal(t, uint16(xtestFakeInput), rs[0].ExtRequests.Minor.First)
+	tt.Equal(t, byte(0), rs[1].ExtRequests.Major.First)
+}